@@ -0,0 +1,96 @@
+// keymove 统计各个结点选择算法在增加或删除一个结点时需要迁移的 key 的比例，
+// 迁移的 key 在新的结点上都不会命中缓存，比例越接近理想值越好。
+//
+//	go run ./cmd/keymove -nodes 10 -keys 100000
+package main
+
+import (
+	"cache/geecache/placement"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+//scenario 是结点变化的一种情况，ideal 是理想情况下需要迁移的比例
+type scenario struct {
+	name   string
+	change func(p placement.Placement, nodes []string)
+	ideal  func(n int) float64
+}
+
+var scenarios = []scenario{
+	{
+		name:   "add node",
+		change: func(p placement.Placement, nodes []string) { p.Add(nodeName(len(nodes))) },
+		ideal:  func(n int) float64 { return 1 / float64(n+1) },
+	},
+	{
+		name:   "remove last",
+		change: func(p placement.Placement, nodes []string) { p.Remove(nodes[len(nodes)-1]) },
+		ideal:  func(n int) float64 { return 1 / float64(n) },
+	},
+	{
+		name:   "remove first",
+		change: func(p placement.Placement, nodes []string) { p.Remove(nodes[0]) },
+		ideal:  func(n int) float64 { return 1 / float64(n) },
+	},
+}
+
+func nodeName(i int) string {
+	return fmt.Sprintf("http://10.0.%d.%d:8001", i/250, i%250+1)
+}
+
+func main() {
+	var algos string
+	var nodes, keys, replicas int
+	flag.StringVar(&algos, "algo", "all", "Comma separated placements to compare: "+strings.Join(placement.Names, ", ")+" or all")
+	flag.IntVar(&nodes, "nodes", 10, "Number of nodes before the change")
+	flag.IntVar(&keys, "keys", 100000, "Number of keys to place")
+	flag.IntVar(&replicas, "replicas", 50, "Virtual nodes per node on the consistent hash ring")
+	flag.Parse()
+	if nodes < 2 || keys < 1 {
+		log.Fatal("need at least 2 nodes and 1 key")
+	}
+
+	names := placement.Names
+	if algos != "all" {
+		names = strings.Split(algos, ",")
+	}
+	nodeList := make([]string, nodes)
+	for i := range nodeList {
+		nodeList[i] = nodeName(i)
+	}
+	keyList := make([]string, keys)
+	for i := range keyList {
+		keyList[i] = "key" + strconv.Itoa(i)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "placement")
+	for _, s := range scenarios {
+		fmt.Fprintf(w, "\t%s", s.name)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "ideal")
+	for _, s := range scenarios {
+		fmt.Fprintf(w, "\t%.4f", s.ideal(nodes))
+	}
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s", name)
+		for _, s := range scenarios {
+			p, err := placement.New(name, replicas)
+			if err != nil {
+				log.Fatal(err)
+			}
+			moved := placement.Movement(p, nodeList, keyList, func(p placement.Placement) { s.change(p, nodeList) })
+			fmt.Fprintf(w, "\t%.4f", moved)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
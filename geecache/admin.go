@@ -0,0 +1,121 @@
+package geecache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Membership 是某一时刻哈希环成员的快照
+type Membership struct {
+	Self  string   `json:"self"`
+	Peers []string `json:"peers"` //按地址排序
+	Epoch uint64   `json:"epoch"` //哈希环每变化一次加 1，可以用来判断两次读取之间是否发生了变化
+	//SentinelEpoch 是收到的哨兵消息中最大的 epoch，比较各个结点的 SentinelEpoch 和 PeerEpochs 可以发现它们对集群的看法是否一致
+	SentinelEpoch uint64            `json:"sentinel_epoch"`
+	PeerEpochs    map[string]uint64 `json:"peer_epochs,omitempty"`
+}
+
+// Membership 返回当前哈希环的成员
+func (p *HTTPPool) Membership() Membership {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	epochs := make(map[string]uint64, len(p.peerEpochs))
+	for peer, epoch := range p.peerEpochs {
+		epochs[peer] = epoch
+	}
+	return Membership{Self: p.self, Peers: peers, Epoch: p.epoch, SentinelEpoch: p.sentinelEpoch, PeerEpochs: epochs}
+}
+
+//adminRequest 是 POST 和 DELETE 请求的请求体
+type adminRequest struct {
+	Peers []string `json:"peers"`
+}
+
+// ServeAdminPeers 管理哈希环的成员：GET 返回当前成员以及哨兵消息的 epoch，POST 添加结点，DELETE 删除结点，
+// 结点可以通过 ?peer=http://localhost:8004 (可以重复)或者 JSON 请求体 {"peers": [...]} 指定，
+// 所有请求都返回修改之后的 Membership。请求需要带上 HTTPPoolOptions.AdminToken，没有配置 AdminToken 时返回 403
+func (p *HTTPPool) ServeAdminPeers(w http.ResponseWriter, r *http.Request) {
+	if !p.checkAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		peers, err := adminPeers(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			p.AddPeer(peers...)
+			p.Log("admin add peers %v", peers)
+		} else {
+			p.RemovePeer(peers...)
+			p.Log("admin remove peers %v", peers)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Membership())
+}
+
+//checkAdmin 检查请求是否带有正确的 AdminToken，没有配置 AdminToken 时返回 403，令牌错误时返回 401，检查失败时已经写入了响应
+func (p *HTTPPool) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if p.opts.AdminToken == "" {
+		http.Error(w, "admin API is disabled", http.StatusForbidden)
+		return false
+	}
+	if !p.adminAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+//adminAuthorized 判断请求是否带有正确的 AdminToken，使用常数时间的比较，避免通过响应时间猜出令牌
+func (p *HTTPPool) adminAuthorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || auth[:len(prefix)] != prefix {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(p.opts.AdminToken)) == 1
+}
+
+//adminPeers 从查询参数或者请求体中取出结点地址，地址必须形如 http://host:port
+func adminPeers(r *http.Request) ([]string, error) {
+	peers := r.URL.Query()["peer"]
+	if len(peers) == 0 && r.ContentLength != 0 {
+		req := adminRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		peers = req.Peers
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peer given")
+	}
+	for _, peer := range peers {
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return nil, fmt.Errorf("invalid peer address: %q", peer)
+		}
+	}
+	return peers, nil
+}
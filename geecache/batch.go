@@ -0,0 +1,248 @@
+package geecache
+
+import (
+	"cache/geecache/pb"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+//BatchGetter 由能够一次加载多个 key 的 Getter 实现，GetMulti 会把本结点负责的未命中 key 一次性交给它
+//返回的 map 中不存在的 key 视为加载失败
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// GetMulti 批量获取多个 key，返回成功获取的 key 和 value，获取失败的 key 不会出现在结果中
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 先查本地缓存，再把未命中的 key 按所属结点分组，每个远程结点只发送一次批量请求，
+// 属于本结点的 key 由 Getter 加载。开启副本时与 Get 一样，先向主结点批量请求，失败的 key 再依次请求副本结点，
+// 自己也保存的 key 放入 mainCache，在本结点加载的 key 推送给副本结点。
+// 远程请求失败的 key 与 Get 一样按照 g.failover 处理：
+// 依次尝试后续结点，最后在本结点加载(SkipCache 时不放入 mainCache)，FailFast 时不再加载，不出现在结果中
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	seen := make(map[string]bool, len(keys))
+	var local []string
+	remote := make(map[PeerGetter][]string)
+	picker, replicated := g.peers.(ReplicaPicker)
+	replicated = replicated && g.replicas > 1
+	owners := make(map[string][]PeerGetter) //开启副本时每个 key 的主结点和副本结点，nil 表示自己
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.stats.Gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			g.stats.CacheHits.Add(1)
+			values[key] = v
+			continue
+		}
+		g.stats.Loads.Add(1)
+		if replicated {
+			owners[key] = picker.PickReplicas(key, g.replicas)
+			if o := owners[key]; len(o) > 0 && o[0] != nil && !fromPeer(ctx) {
+				remote[o[0]] = append(remote[o[0]], key)
+				continue
+			}
+		} else if g.peers != nil && !fromPeer(ctx) {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				remote[peer] = append(remote[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var fallback []string //所有远程结点都失败、不属于本结点的 key
+	for peer, peerKeys := range remote {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			res, failed, peerErr := g.getMultiFromPeer(ctx, peer, peerKeys)
+			for _, key := range failed {
+				value, self, err := g.retryFromPeers(ctx, key, peer, owners[key], peerErr)
+				if err == nil && !self {
+					res[key] = value
+					continue
+				}
+				mu.Lock()
+				if self {
+					local = append(local, key)
+				} else {
+					fallback = append(fallback, key)
+				}
+				mu.Unlock()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range res {
+				if containsPeer(owners[k], nil) {
+					g.populateCache(k, v)
+				}
+				values[k] = v
+			}
+		}(peer, peerKeys)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return values, err
+	}
+	switch {
+	case len(fallback) > 0 && g.failover.FailFast:
+		log.Printf("[GeeCache] failed to get %d keys from peers", len(fallback))
+	case g.failover.SkipCache:
+		for k, v := range g.getMultiLocally(ctx, fallback, false) {
+			values[k] = v
+		}
+	default:
+		//与本结点负责的 key 一起加载，只调用一次 BatchGetter
+		local = append(local, fallback...)
+	}
+	for k, v := range g.getMultiLocally(ctx, local, true) {
+		if g.pushReplicas && containsPeer(owners[k], nil) {
+			g.pushToReplicas(owners[k], k, v)
+		}
+		values[k] = v
+	}
+	return values, ctx.Err()
+}
+
+//retryFromPeers 在 key 的批量请求失败之后依次请求 owners 中 peer 之后的副本结点，轮到自己时返回 true，
+//所有副本都失败之后按照 g.failover 尝试后续结点。owners 为 nil 表示没有开启副本
+func (g *Group) retryFromPeers(ctx context.Context, key string, peer PeerGetter, owners []PeerGetter, err error) (ByteView, bool, error) {
+	if owners == nil {
+		return g.tryNextPeers(ctx, key, []PeerGetter{peer}, err)
+	}
+	for _, replica := range owners {
+		if replica == peer {
+			continue
+		}
+		if replica == nil {
+			return ByteView{}, true, err
+		}
+		var value ByteView
+		value, err = g.getFromPeer(ctx, replica, key)
+		if err == nil {
+			g.stats.ReplicaLoads.Add(1)
+			return value, false, nil
+		}
+		log.Println("[GeeCache] failed to get from replica", err)
+		if ctx.Err() != nil {
+			return ByteView{}, false, ctx.Err()
+		}
+	}
+	return g.tryNextPeers(ctx, key, owners, err)
+}
+
+//getMultiFromPeer 向一个远程结点批量查询 keys，返回获取失败的 key 以及最后一个错误
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string) (map[string]ByteView, []string, error) {
+	values := make(map[string]ByteView, len(keys))
+	batch, ok := peer.(BatchPeerGetter)
+	if !ok {
+		//远程结点不支持批量查询，退化为逐个查询
+		var failed []string
+		var lastErr error
+		for _, key := range keys {
+			g.stats.LoadsDeduped.Add(1)
+			if v, err := g.getFromPeer(ctx, peer, key); err == nil {
+				values[key] = v
+			} else {
+				failed, lastErr = append(failed, key), err
+			}
+		}
+		return values, failed, lastErr
+	}
+
+	req := &pb.BatchRequest{
+		Group: g.name,
+		Keys: keys,
+	}
+	res := &pb.BatchResponse{}
+	//一次批量请求只算一次实际的加载
+	g.stats.LoadsDeduped.Add(1)
+	start := time.Now()
+	err := batch.GetMulti(ctx, req, res)
+	g.peerLatency.since(start)
+	if err != nil {
+		log.Println("[GeeCache] failed to get multi from peer", err)
+		if !errors.Is(err, context.Canceled) {
+			g.stats.PeerErrors.Add(1)
+		}
+		return values, keys, err
+	}
+	g.stats.PeerLoads.Add(int64(len(res.GetValues())))
+	for k, v := range res.GetValues() {
+		value := ByteView{b: v}
+		g.populateHotCache(k, value)
+		values[k] = value
+	}
+	return values, nil, nil
+}
+
+//getMultiLocally 使用 Getter 加载 keys，Getter 实现了 BatchGetter 时只调用一次，cache 为 false 时不放入 mainCache
+func (g *Group) getMultiLocally(ctx context.Context, keys []string, cache bool) map[string]ByteView {
+	values := make(map[string]ByteView, len(keys))
+	if len(keys) == 0 {
+		return values
+	}
+
+	getter, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, key := range keys {
+			load := g.loadLocally
+			if !cache {
+				load = g.callGetter
+			}
+			if v, err := load(ctx, key); err == nil {
+				values[key] = v
+			}
+		}
+		return values
+	}
+
+	//批量加载没有经过 singleflight，但只调用了一次 Getter，算作一次实际的加载
+	g.stats.LoadsDeduped.Add(1)
+	start := time.Now()
+	res, err := getter.GetMulti(ctx, keys)
+	g.localLatency.since(start)
+	if err != nil {
+		log.Println("[GeeCache] failed to get multi locally", err)
+		g.stats.LocalLoadErrs.Add(1)
+		return values
+	}
+	g.stats.LocalLoads.Add(int64(len(res)))
+	for _, key := range keys {
+		if bytes, ok := res[key]; ok {
+			value := ByteView{b: cloneBytes(bytes)}
+			if cache {
+				g.populateCache(key, value)
+			}
+			values[key] = value
+		}
+	}
+	return values
+}
+
+//loadLocally 与 load 相同，使用 singleflight 保证并发请求只加载一次，但不会再向远程结点查询
+func (g *Group) loadLocally(ctx context.Context, key string) (ByteView, error) {
+	viewi, err := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		ctx, cancel := g.loadContext(ctx)
+		defer cancel()
+		g.stats.LoadsDeduped.Add(1)
+		return g.getLocally(ctx, key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
@@ -0,0 +1,179 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//ErrBreakerOpen 表示远程结点的熔断器处于打开状态，请求没有发出
+var ErrBreakerOpen = errors.New("geecache: peer circuit breaker is open")
+
+// BreakerConfig 配置 HTTPPool 中每个远程结点的熔断器。
+// 在 Window 时间内至少有 MinRequests 个请求，并且失败的比例达到 ErrorRate 时熔断器打开，PickPeer 不再选择该结点；
+// 经过 OpenTimeout 之后进入半开状态，放行一个探测请求，成功则关闭，失败则再次打开
+type BreakerConfig struct {
+	Window      time.Duration //统计错误率的时间窗口
+	MinRequests int           //窗口内的请求数达到 MinRequests 之后才会熔断，避免少量请求失败就熔断
+	ErrorRate   float64       //失败请求的比例，小于等于 0 时关闭熔断器
+	SlowCall    time.Duration //耗时超过 SlowCall 的请求也视为失败，0 表示不考虑延迟
+	OpenTimeout time.Duration //打开状态持续的时间
+}
+
+// DefaultBreakerConfig 是 NewHTTPPool 使用的熔断器配置
+var DefaultBreakerConfig = BreakerConfig{
+	Window:      10 * time.Second,
+	MinRequests: 5,
+	ErrorRate:   0.5,
+	OpenTimeout: time.Second,
+}
+
+//breakerState 是熔断器的状态
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+//breaker 是一个远程结点的熔断器，根据请求的失败率和延迟在关闭、打开和半开三种状态之间切换
+type breaker struct {
+	mu          sync.Mutex
+	cfg         BreakerConfig
+	state       breakerState
+	since       time.Time //进入当前状态的时刻，半开状态下是探测请求发出的时刻
+	windowStart time.Time
+	requests    int
+	failures    int
+	probing     bool //半开状态下是否有探测请求尚未结束
+	now         func() time.Time
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	return &breaker{cfg: cfg, now: time.Now}
+}
+
+//configure 更换配置并回到关闭状态
+func (b *breaker) configure(cfg BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = cfg
+	b.setState(breakerClosed)
+}
+
+//setState 切换状态并清空计数，调用时需持有 b.mu
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	b.since = b.now()
+	b.windowStart = b.since
+	b.requests, b.failures = 0, 0
+	b.probing = false
+}
+
+//ready 判断是否可以向结点发送请求，不会改变状态，供 PickPeer 选择结点时使用
+func (b *breaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.ErrorRate <= 0 {
+		return true
+	}
+	switch b.state {
+	case breakerOpen:
+		return b.now().Sub(b.since) >= b.cfg.OpenTimeout
+	case breakerHalfOpen:
+		return b.probeExpired()
+	default:
+		return true
+	}
+}
+
+//probeExpired 判断半开状态下是否可以发出新的探测请求。上一个探测请求超过 OpenTimeout 还没有结束时也允许，
+//避免探测请求没有被记录时一直停留在半开状态。调用时需持有 b.mu
+func (b *breaker) probeExpired() bool {
+	return !b.probing || b.now().Sub(b.since) >= b.cfg.OpenTimeout
+}
+
+//allow 在发送请求之前调用，返回 false 时不应发送请求。打开状态超过 OpenTimeout 之后进入半开状态，只放行一个探测请求
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.ErrorRate <= 0 {
+		return true
+	}
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.since) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if !b.probeExpired() {
+			return false
+		}
+		b.since = b.now()
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+//record 记录一个耗时为 d 的请求的结果。请求方主动取消的请求不代表结点的状况，不计入统计
+func (b *breaker) record(err error, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.ErrorRate <= 0 {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		if b.state == breakerHalfOpen {
+			b.probing = false
+		}
+		return
+	}
+	failed := err != nil || (b.cfg.SlowCall > 0 && d > b.cfg.SlowCall)
+
+	switch b.state {
+	case breakerHalfOpen:
+		if failed {
+			b.setState(breakerOpen)
+		} else {
+			b.setState(breakerClosed)
+		}
+	case breakerClosed:
+		if now := b.now(); now.Sub(b.windowStart) > b.cfg.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.ErrorRate*float64(b.requests) {
+			b.setState(breakerOpen)
+		}
+	}
+	//打开状态下结束的请求是在熔断之前发出的，忽略
+}
+
+//current 返回当前的状态
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,153 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//fakeClock 是可以手动拨动的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestBreaker(cfg BreakerConfig) (*breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newBreaker(cfg)
+	b.now = clock.now
+	b.configure(cfg)
+	return b, clock
+}
+
+func TestBreaker(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{Window: time.Second, MinRequests: 4, ErrorRate: 0.5, OpenTimeout: time.Second})
+	down := errors.New("connection refused")
+
+	//请求数不足 MinRequests 时不会熔断
+	for i := 0; i < 3; i++ {
+		b.record(down, time.Millisecond)
+	}
+	if b.current() != breakerClosed {
+		t.Fatalf("breaker should stay closed with too few requests, got %v", b.current())
+	}
+	//窗口过期之后重新计数
+	clock.t = clock.t.Add(2 * time.Second)
+	b.record(nil, time.Millisecond)
+	b.record(nil, time.Millisecond)
+	b.record(down, time.Millisecond)
+	if b.current() != breakerClosed {
+		t.Fatalf("1 of 3 failed in the new window, got %v", b.current())
+	}
+	b.record(down, time.Millisecond)
+	if b.current() != breakerOpen || b.ready() || b.allow() {
+		t.Fatalf("2 of 4 failed, breaker should be open, got %v", b.current())
+	}
+
+	//经过 OpenTimeout 之后只放行一个探测请求，探测失败时再次打开
+	clock.t = clock.t.Add(time.Second)
+	if !b.ready() || !b.allow() {
+		t.Fatal("breaker should let a probe through after OpenTimeout")
+	}
+	if b.current() != breakerHalfOpen || b.ready() || b.allow() {
+		t.Fatal("only one probe should be allowed in half-open state")
+	}
+	b.record(down, time.Millisecond)
+	if b.current() != breakerOpen {
+		t.Fatalf("failed probe should open the breaker, got %v", b.current())
+	}
+
+	//探测成功时关闭
+	clock.t = clock.t.Add(time.Second)
+	b.allow()
+	b.record(nil, time.Millisecond)
+	if b.current() != breakerClosed || !b.allow() {
+		t.Fatalf("successful probe should close the breaker, got %v", b.current())
+	}
+}
+
+func TestBreakerSlowCallsAndCancel(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{Window: time.Second, MinRequests: 2, ErrorRate: 1, SlowCall: 100 * time.Millisecond, OpenTimeout: time.Second})
+
+	//请求方取消的请求不计入统计
+	b.record(context.Canceled, time.Second)
+	b.record(context.Canceled, time.Second)
+	if b.current() != breakerClosed {
+		t.Fatal("canceled requests should not open the breaker")
+	}
+	//成功但是太慢的请求视为失败
+	b.record(nil, time.Second)
+	b.record(nil, time.Second)
+	if b.current() != breakerOpen {
+		t.Fatalf("slow calls should open the breaker, got %v", b.current())
+	}
+
+	//探测请求被取消时允许发出新的探测请求
+	clock.t = clock.t.Add(time.Second)
+	b.allow()
+	b.record(context.Canceled, 0)
+	if b.current() != breakerHalfOpen || !b.allow() {
+		t.Fatal("a canceled probe should let another probe through")
+	}
+
+	//关闭熔断器之后总是放行
+	b.configure(BreakerConfig{})
+	for i := 0; i < 10; i++ {
+		b.record(errors.New("boom"), time.Second)
+	}
+	if !b.allow() {
+		t.Fatal("disabled breaker should allow every request")
+	}
+}
+
+func TestPickPeerSkipsOpenBreaker(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+
+	self := "http://localhost:8001"
+	pool := NewHTTPPool(self)
+	pool.SetBreaker(BreakerConfig{Window: time.Minute, MinRequests: 2, ErrorRate: 0.5, OpenTimeout: time.Minute})
+	pool.Set(self, dead.URL, "http://localhost:8003")
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if pool.peers.Get(fmt.Sprintf("key%d", i)) == dead.URL {
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	peer, ok := pool.PickPeer(key)
+	if !ok || peer.(*httpGetter).baseURL != dead.URL+defaultBasePath {
+		t.Fatalf("%s should be picked while its breaker is closed", dead.URL)
+	}
+
+	g := newGroup("breaker", 2 << 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	for i := 0; i < 2; i++ {
+		if _, err := g.getFromPeer(context.Background(), peer, key); err == nil {
+			t.Fatal("dead peer should fail")
+		}
+	}
+	if err := peer.Get(nil, nil); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("requests to an open peer should fail without being sent, got %v", err)
+	}
+
+	//熔断器打开之后 key 交给哈希环上的下一个结点
+	if next, ok := pool.PickPeer(key); ok && next.(*httpGetter).baseURL == dead.URL+defaultBasePath {
+		t.Fatal("peer with an open breaker should be skipped")
+	}
+	for _, p := range pool.PickReplicas(key, 3) {
+		if p != nil && p.(*httpGetter).baseURL == dead.URL+defaultBasePath {
+			t.Fatal("peer with an open breaker should not be a replica")
+		}
+	}
+}
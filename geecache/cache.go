@@ -1,25 +1,68 @@
 package geecache
 
-import "sync"
-import "cache/geecache/lru"
+import (
+	"cache/geecache/lru"
+	"sync"
+	"time"
+)
 
 //实例化 lru，封装 get 和 add 方法，并添加互斥锁 mu
 type cache struct {
 	mu sync.Mutex
 	lru *lru.Cache
 	cacheBytes int64
+	stop chan struct{} //关闭时停止 janitor
+	stopOnce sync.Once
+	nget, nhit, nevict AtomicInt //查询次数、命中次数和淘汰次数
+}
+
+//CacheStats 是某个 cache 的统计信息
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"`
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{
+		Gets:      c.nget.Get(),
+		Hits:      c.nhit.Get(),
+		Evictions: c.nevict.Get(),
+	}
+	if c.lru != nil {
+		s.Bytes = c.lru.Bytes()
+		s.Items = int64(c.lru.Len())
+	}
+	return s
 }
 
 func (c *cache) add(key string, value ByteView) {
+	c.addWithExpiry(key, value, time.Time{})
+}
+
+//addWithExpiry 添加一条在 expire 时刻过期的记录，expire 为零值表示永不过期
+func (c *cache) addWithExpiry(key string, value ByteView, expire time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+		c.lru = lru.NewWithReason(c.cacheBytes, c.onEvicted)
+	}
+	c.lru.AddWithExpiry(key, value, expire)
+}
+
+//onEvicted 统计因容量不足或过期而被淘汰的记录
+func (c *cache) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	if reason != lru.EvictRemoved {
+		c.nevict.Add(1)
 	}
-	c.lru.Add(key, value)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	c.nget.Add(1)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
@@ -27,8 +70,55 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 	}
 
 	if v, ok := c.lru.Get(key); ok {
+		c.nhit.Add(1)
 		return v.(ByteView), ok
 	}
 
 	return
-}
\ No newline at end of file
+}
+
+//remove 删除 key 对应的记录，返回 key 是否存在
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return false
+	}
+	return c.lru.Remove(key)
+}
+
+//startJanitor 启动后台 goroutine，每隔 interval 清理一次所有过期记录，避免过期但不再被访问的数据一直占用内存，
+//需要调用 stopJanitor 停止
+func (c *cache) startJanitor(interval time.Duration) {
+	c.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.removeExpired()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+//stopJanitor 停止 startJanitor 启动的 goroutine，可以重复调用
+func (c *cache) stopJanitor() {
+	c.stopOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+		}
+	})
+}
+
+//removeExpired 删除所有过期的记录
+func (c *cache) removeExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.RemoveExpired()
+	}
+}
@@ -1,79 +1,271 @@
 package consistenthash
 
 import (
-	"fmt"
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Hash func(data []byte) uint32
 
+//Map 是一致性哈希环，可以在修改结点的同时并发地调用 Get。
+//每次修改都会复制出一个新的环(copy-on-write)，然后原子地替换，读操作总是看到某一个完整的快照，不需要加锁
 type Map struct {
-	hash Hash				//hash函数
-	replicas int			//虚拟节点倍数
-	keys []int				//哈希环
-	hashMap map[int]string	//虚拟节点和真实结点的映射,键是虚拟节点的哈希值，值是真实节点的名称。
+	hash     Hash       //hash函数
+	replicas int        //虚拟节点倍数
+	mu       sync.Mutex //保证同一时间只有一个修改
+	ring     atomic.Value
+}
+
+//vnode 是环上的一个虚拟结点，owner 是它所属的真实结点。
+//不同真实结点的虚拟结点的哈希值可能相同(碰撞)，此时它们都保留在环上，按 owner 排序，删除时只删除自己的虚拟结点
+type vnode struct {
+	hash  uint32
+	owner string
+}
+
+//ring 是哈希环的一个快照，创建之后不再修改
+type ring struct {
+	vnodes []vnode          //按 (hash, owner) 排序
+	nodes  map[string]int   //环上的真实结点及其权重
 }
 
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash: fn,
-		hashMap: make(map[int]string),
 	}
 	//hash算法默认采用crc32/ChecksumIEEE算法
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
 	}
+	m.ring.Store(&ring{nodes: make(map[string]int)})
 	return m
 }
 
-//Add 方法对应的是增加Map的真实结点，传入的是若干个结点的名称
+//load 返回当前的快照
+func (m *Map) load() *ring {
+	return m.ring.Load().(*ring)
+}
+
+//vnodesOf 计算权重为 weight 的结点 key 的所有虚拟节点，共 replicas*weight 个，虚拟节点的名字是[编号]+真实结点的名字
+func (m *Map) vnodesOf(key string, weight int) []vnode {
+	vnodes := make([]vnode, m.replicas*weight)
+	for i := range vnodes {
+		vnodes[i] = vnode{hash: m.hash([]byte(strconv.Itoa(i) + key)), owner: key}
+	}
+	return vnodes
+}
+
+//Add 方法对应的是增加Map的真实结点，传入的是若干个结点的名称，权重都为 1，已经在环上的结点会被忽略
 func (m *Map) Add(keys ...string) {
-	fmt.Println("func (m *Map) Add(keys ...string)")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.load()
+	weights := make(map[string]int, len(keys))
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {	//对每个结点,创建replicas个虚拟节点,虚拟节点的名字是[编号]+真实结点的名字
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))	//计算每个虚拟结点的hash值
-			m.keys = append(m.keys, hash)						//将对应的哈希值添加到环上
-			m.hashMap[hash] = key								//建立虚拟结点hash值和名字之间的映射
+		if _, ok := old.nodes[key]; !ok {
+			weights[key] = 1
+		}
+	}
+	m.store(old, weights)
+}
+
+//AddWeighted 增加权重为 weight 的真实结点，虚拟节点的数量与权重成正比，
+//例如内存是其他结点两倍的结点可以使用权重 2。结点已经在环上时更新其权重，weight 小于 1 时视为 1
+func (m *Map) AddWeighted(key string, weight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if weight < 1 {
+		weight = 1
+	}
+	old := m.load()
+	if w, ok := old.nodes[key]; ok && w == weight {
+		return
+	}
+	m.store(old, map[string]int{key: weight})
+}
+
+//AddWeights 与 AddWeighted 相同，但一次加入多个结点，整个环只重建一次
+func (m *Map) AddWeights(weights map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.load()
+	changed := make(map[string]int, len(weights))
+	for key, weight := range weights {
+		if weight < 1 {
+			weight = 1
+		}
+		if w, ok := old.nodes[key]; !ok || w != weight {
+			changed[key] = weight
+		}
+	}
+	m.store(old, changed)
+}
+
+//store 在 old 的基础上加入或者替换 weights 中的结点，创建新的快照，调用时需持有 m.mu
+func (m *Map) store(old *ring, weights map[string]int) {
+	if len(weights) == 0 {
+		return
+	}
+	r := &ring{
+		vnodes: make([]vnode, 0, len(old.vnodes)),
+		nodes:  make(map[string]int, len(old.nodes)+len(weights)),
+	}
+	for node, w := range old.nodes {
+		r.nodes[node] = w
+	}
+	for _, v := range old.vnodes {
+		if _, ok := weights[v.owner]; !ok {
+			r.vnodes = append(r.vnodes, v)
 		}
 	}
+	for key, w := range weights {
+		r.nodes[key] = w
+		r.vnodes = append(r.vnodes, m.vnodesOf(key, w)...)
+	}
 
-	sort.Ints(m.keys)											//最后对所有哈希值排序
+	//最后对所有虚拟节点排序，哈希值相同时按照真实结点的名字排序，保证每个结点上的结果一致
+	sort.Slice(r.vnodes, func(i, j int) bool {
+		if r.vnodes[i].hash != r.vnodes[j].hash {
+			return r.vnodes[i].hash < r.vnodes[j].hash
+		}
+		return r.vnodes[i].owner < r.vnodes[j].owner
+	})
+	m.ring.Store(r)
 }
 
-// Get 方法实现选择结点
+// Get 方法实现选择结点，环为空时返回空字符串
 func (m *Map) Get(key string) string {
-	fmt.Println("func (m *Map) Get(key string) string")
-	if len(m.keys) == 0 {
+	r := m.load()
+	if len(r.vnodes) == 0 {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
-	idx := sort.Search(len(m.keys), func(i int) bool {			//二分查找key在keys中满足条件的虚拟节点
-		return m.keys[i] >= hash
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(r.vnodes), func(i int) bool {			//二分查找key在环上满足条件的虚拟节点
+		return r.vnodes[i].hash >= hash
+	})
+
+	//当key比所有虚拟节点都大的时候，idx可能等于len(r.vnodes)所以需要取余
+	return r.vnodes[idx % len(r.vnodes)].owner
+}
+
+//GetN 返回从 key 的位置开始沿着环顺时针遇到的前 n 个不同的真实结点，第一个就是 Get 的结果，
+//后面的结点可以作为 key 的副本。环上的结点少于 n 个时返回所有结点
+func (m *Map) GetN(key string, n int) []string {
+	r := m.load()
+	if len(r.vnodes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(r.vnodes), func(i int) bool {
+		return r.vnodes[i].hash >= hash
 	})
+	owners := make([]string, 0, n)
+	for i := 0; i < len(r.vnodes) && len(owners) < n; i++ {
+		owner := r.vnodes[(idx+i) % len(r.vnodes)].owner
+		if !contains(owners, owner) {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+//GetBounded 实现了有界负载的一致性哈希(consistent hashing with bounded loads)：
+//loads 是每个结点当前的负载，例如正在处理的请求数。加上这一次请求后，每个结点的负载上限是
+//(1+epsilon)×平均负载(有权重时按权重分配)，key 所属的结点超过上限时沿着环顺时针寻找下一个没有超过上限的结点。
+//epsilon 越小负载越均衡，但 key 越容易偏离原来的结点；所有结点都没有超过上限时结果与 Get 相同
+func (m *Map) GetBounded(key string, loads map[string]int64, epsilon float64) string {
+	r := m.load()
+	if len(r.vnodes) == 0 {
+		return ""
+	}
 
-	//keys通过索引获取hash值，hashMap通过hash值获取真实结点。当key比m.keys所有都大的时候，idx可能等于len(m.keys)所以需要取余
-	return m.hashMap[m.keys[idx % len(m.keys)]]
+	var total int64 = 1 //包括这一次请求
+	weights := 0
+	for node, w := range r.nodes {
+		total += loads[node]
+		weights += w
+	}
+
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(r.vnodes), func(i int) bool {
+		return r.vnodes[i].hash >= hash
+	})
+	checked := make(map[string]bool, len(r.nodes))
+	for i := 0; i < len(r.vnodes) && len(checked) < len(r.nodes); i++ {
+		owner := r.vnodes[(idx+i) % len(r.vnodes)].owner
+		if checked[owner] {
+			continue
+		}
+		checked[owner] = true
+		capacity := math.Ceil((1 + epsilon) * float64(total) * float64(r.nodes[owner]) / float64(weights))
+		if float64(loads[owner]+1) <= capacity {
+			return owner
+		}
+	}
+	//上限向上取整，总有结点不会超过上限，这里只是以防万一
+	return r.vnodes[idx % len(r.vnodes)].owner
 }
 
+//Remove 删除真实结点 key 的所有虚拟节点，与其碰撞的其他结点的虚拟节点不受影响
 func (m *Map) Remove(key string) {
-	fmt.Println("func (m *Map) Remove(keys ...string)")
-	dMap := make(map[int]bool)
-	for i := 0; i < m.replicas; i++ {
-		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-		dMap[hash] = true
-		delete(m.hashMap, hash)
-	}
-
-	//切片中删除多个
-	for i := 0; i < len(m.keys); i++ {
-		if _, ok := dMap[m.keys[i]]; ok {
-			m.keys = append(m.keys[:i], m.keys[i+1:]...)
-			i = i - 1
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.load()
+	if _, ok := old.nodes[key]; !ok {
+		return
+	}
+	r := &ring{
+		vnodes: make([]vnode, 0, len(old.vnodes)),
+		nodes:  make(map[string]int, len(old.nodes)),
+	}
+	for node, w := range old.nodes {
+		if node != key {
+			r.nodes[node] = w
+		}
+	}
+	for _, v := range old.vnodes {
+		if v.owner != key {
+			r.vnodes = append(r.vnodes, v)
 		}
 	}
+	m.ring.Store(r)
+}
+
+//Nodes 返回环上所有的真实结点，按名字排序
+func (m *Map) Nodes() []string {
+	r := m.load()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
 
-}
\ No newline at end of file
+//Weight 返回结点 key 的权重，结点不在环上时返回 0
+func (m *Map) Weight(key string) int {
+	return m.load().nodes[key]
+}
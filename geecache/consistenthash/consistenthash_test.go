@@ -1,7 +1,9 @@
 package consistenthash
 
 import (
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -39,3 +41,210 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	hash.Remove("4")
+
+	//4 的虚拟节点 4,14,24 被删除后，原来属于它的 key 顺延到下一个结点
+	testCases := map[string]string{
+		"3":  "6",
+		"13": "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	if nodes := hash.Nodes(); len(nodes) != 2 || nodes[0] != "2" || nodes[1] != "6" {
+		t.Errorf("unexpected nodes %v", nodes)
+	}
+
+	hash.Remove("2")
+	hash.Remove("6")
+	hash.Remove("6")
+	if hash.Get("1") != "" {
+		t.Errorf("empty ring should yield nothing")
+	}
+}
+
+func TestCollision(t *testing.T) {
+	//所有虚拟节点的哈希值只取决于编号，A 和 B 的虚拟节点两两碰撞
+	hash := New(3, func(key []byte) uint32 {
+		if len(key) > 1 {
+			return uint32(key[0]-'0') * 10
+		}
+		return uint32(key[0]-'0') * 10 - 5
+	})
+	hash.Add("B", "A")
+
+	//碰撞时按结点名字排序，所有结点上的结果一致
+	if got := hash.Get("1"); got != "A" {
+		t.Fatalf("colliding vnodes should resolve to A, got %s", got)
+	}
+
+	//删除 A 不能删除与其碰撞的 B 的虚拟节点
+	hash.Remove("A")
+	for _, k := range []string{"0", "1", "2", "3"} {
+		if got := hash.Get(k); got != "B" {
+			t.Fatalf("Asking for %s, should have yielded B, got %q", k, got)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				//a、b 始终在环上，不能读到空结果
+				if hash.Get("key") == "" {
+					t.Error("Get should never see an empty ring")
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		hash.Remove("c")
+		hash.Add("c", strconv.Itoa(i))
+		hash.Remove(strconv.Itoa(i))
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(100, nil)
+	weights := map[string]int{"a": 1, "b": 2, "c": 3}
+	for node, w := range weights {
+		hash.AddWeighted(node, w)
+	}
+
+	const n = 60000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	//每个结点分到的 key 与其权重所占的比例相差不超过 15%
+	for node, w := range weights {
+		want := float64(n) * float64(w) / 6
+		if got := float64(counts[node]); got < want*0.85 || got > want*1.15 {
+			t.Errorf("%s with weight %d got %v keys, want about %v", node, w, got, want)
+		}
+	}
+
+	//修改权重后虚拟节点的数量随之改变
+	hash.AddWeighted("a", 3)
+	if hash.Weight("a") != 3 || len(hash.load().vnodes) != 100*8 {
+		t.Errorf("a should have weight 3 and the ring 800 vnodes, got %d and %d", hash.Weight("a"), len(hash.load().vnodes))
+	}
+	hash.Add("a")
+	if hash.Weight("a") != 3 {
+		t.Errorf("Add should not change the weight of an existing node")
+	}
+
+	//AddWeights 与逐个调用 AddWeighted 得到相同的环
+	batch := New(100, nil)
+	batch.AddWeights(map[string]int{"a": 3, "b": 2, "c": 3})
+	if !reflect.DeepEqual(batch.load().vnodes, hash.load().vnodes) {
+		t.Errorf("AddWeights should build the same ring as AddWeighted")
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	if hash.GetN("11", 2) != nil {
+		t.Error("empty ring should yield nothing")
+	}
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want []string
+	}{
+		{"11", 3, []string{"2", "4", "6"}},
+		{"23", 2, []string{"4", "6"}},
+		//跨过环的末尾继续寻找
+		{"25", 3, []string{"6", "2", "4"}},
+		//结点不足 n 个时返回所有结点
+		{"27", 5, []string{"2", "4", "6"}},
+		{"27", 0, nil},
+	}
+	for _, c := range testCases {
+		if got := hash.GetN(c.key, c.n); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Asking for %d nodes of %s, should have yielded %v, got %v", c.n, c.key, c.want, got)
+		}
+		if c.n > 0 && hash.GetN(c.key, c.n)[0] != hash.Get(c.key) {
+			t.Errorf("the first node of %s should be its owner", c.key)
+		}
+	}
+}
+
+func TestGetBounded(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+
+	//没有负载时与 Get 相同
+	for _, k := range []string{"2", "11", "23", "27"} {
+		if got, want := hash.GetBounded(k, nil, 0.25), hash.Get(k); got != want {
+			t.Errorf("Asking for %s, should have yielded %s, got %s", k, want, got)
+		}
+	}
+
+	//11 属于 2，但 2 超过了上限 ceil(1.25*6/3)=3，顺延到环上的下一个结点 4
+	loads := map[string]int64{"2": 5}
+	if got := hash.GetBounded("11", loads, 0.25); got != "4" {
+		t.Errorf("overloaded 2 should be skipped, got %s", got)
+	}
+	//4 也超过上限时继续顺延到 6
+	loads["4"] = 5
+	if got := hash.GetBounded("11", loads, 0.25); got != "6" {
+		t.Errorf("overloaded 2 and 4 should be skipped, got %s", got)
+	}
+	//27 属于 2，跨过环的末尾继续寻找
+	if got := hash.GetBounded("27", loads, 0.25); got != "6" {
+		t.Errorf("walk should wrap around the ring, got %s", got)
+	}
+}
+
+func TestGetBoundedBalance(t *testing.T) {
+	hash := New(100, nil)
+	hash.Add("a", "b", "c", "d")
+
+	//模拟每个请求都一直不结束，任何结点的负载都不能超过 (1+epsilon) 倍的平均值
+	const epsilon = 0.25
+	loads := make(map[string]int64)
+	for i := 0; i < 1000; i++ {
+		loads[hash.GetBounded("key"+strconv.Itoa(i%10), loads, epsilon)]++
+	}
+	for node, load := range loads {
+		if float64(load) > (1+epsilon)*1000/4+1 {
+			t.Errorf("%s has load %d, more than the bound", node, load)
+		}
+	}
+}
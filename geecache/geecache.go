@@ -3,9 +3,13 @@ package geecache
 import (
 	"cache/geecache/pb"
 	"cache/geecache/singleflight"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 type Getter interface {
@@ -18,103 +22,401 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+//ContextGetter 由能感知 context 的 Getter 实现，Group 会优先调用 GetContext，使慢查询能够被取消
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
 //Group 可以认为是一个缓存的命名空间，每个 Group 拥有一个唯一的名称 name
 //比如可以创建三个 Group，缓存学生的成绩命名为 scores，缓存学生信息的命名为 info，缓存学生课程的命名为 courses。
 type Group struct {
 	name string
 	getter Getter	//缓存未命中时获取源数据的回调(callback)
-	mainCache cache	//一开始实现的并发缓存
+	mainCache cache	//一开始实现的并发缓存，只保存本结点负责的 key
+	hotCache cache	//保存从远程结点获取的部分热点数据，避免每次都通过网络请求
+	hotSample int	//从远程结点获取的数据中，每 hotSample 个抽取一个放入 hotCache
 	peers PeerPicker
 	loader *singleflight.Group	//loader结构体保证key只请求一次
+	stats Stats	//Group 的统计信息
+	localLatency histogram	//通过 Getter 加载的延迟
+	peerLatency histogram	//从远程结点加载的延迟
+	ttl time.Duration	//缓存数据的默认过期时间，0表示永不过期
+	replicas int	//每个 key 保存在多少个结点上，小于 2 时不使用副本
+	pushReplicas bool	//从 Getter 加载到自己保存的 key 之后是否推送给其他副本结点
+	failover Failover	//从远程结点获取失败之后的行为
+	hedgeDelay time.Duration	//大于 0 时，远程结点超过 hedgeDelay 没有响应就发出对冲请求
+	loadTimeout time.Duration	//一次加载最长的时间，加载由所有等待者共享，不随某一个调用者的 ctx 取消，参见 loadContext
+}
+
+//Failover 配置从 key 所属的远程结点获取失败之后的行为，零值与原来的行为相同：直接通过 Getter 加载并放入 mainCache
+type Failover struct {
+	NextPeers int	//依次尝试哈希环上后续的最多 NextPeers 个不同结点，轮到自己时在本结点加载并缓存，需要 PeerPicker 实现 ReplicaPicker
+	SkipCache bool	//通过 Getter 加载的不属于本结点的 key 不放入 mainCache，避免挤占本结点负责的 key
+	FailFast bool	//所有结点都失败之后直接返回错误，不通过 Getter 加载，避免所有结点同时访问数据源
+}
+
+//GroupOption 用于在 NewGroup 时对 Group 进行可选配置
+type GroupOption func(*Group)
+
+//WithTTL 设置 Group 中缓存数据的默认过期时间，过期数据在读取时删除，后台的 janitor 也会每隔 ttl 清理一次所有过期数据，
+//不再使用 Group 时需要调用 Close 停止 janitor
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+//WithHotCache 设置 hotCache 的内存上限，默认为 mainCache 的 1/8，设置为 0 则关闭 hotCache
+func WithHotCache(cacheBytes int64) GroupOption {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = cacheBytes
+	}
+}
+
+//WithReplication 把每个 key 保存在哈希环上连续的 n 个不同结点上：先从主结点获取，失败时依次尝试副本结点，
+//主结点下线时不需要所有 key 都重新从数据源加载。push 为 true 时，结点从 Getter 加载到自己保存的 key 之后
+//会把数据推送给其他副本结点。需要 PeerPicker 实现 ReplicaPicker，否则与不使用副本相同
+func WithReplication(n int, push bool) GroupOption {
+	return func(g *Group) {
+		g.replicas = n
+		g.pushReplicas = push
+	}
+}
+
+//WithFailover 设置从远程结点获取失败之后的行为
+func WithFailover(f Failover) GroupOption {
+	return func(g *Group) {
+		g.failover = f
+	}
+}
+
+//WithHedging 开启对冲请求：key 所属的远程结点超过 delay 还没有响应时，再向哈希环上的下一个副本结点发送一次请求，
+//没有可用的副本结点时通过 Getter 加载。使用最先返回的结果，并取消另一个请求。
+//delay 一般设置为远程请求的 P95 延迟左右，这样只有少量请求会被对冲
+func WithHedging(delay time.Duration) GroupOption {
+	return func(g *Group) {
+		g.hedgeDelay = delay
+	}
+}
+
+//WithLoadTimeout 设置一次加载(从远程结点或者 Getter)最长的时间，默认为 defaultLoadTimeout。
+//并发请求同一个 key 时只加载一次，加载不会因为某一个调用者取消而中断，所以需要单独的超时时间。
+//发起加载的调用者的截止时间更早时使用它的截止时间
+func WithLoadTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = d
+	}
 }
 
+//defaultLoadTimeout 是一次加载默认的最长时间
+const defaultLoadTimeout = 10 * time.Second
+
+//pushTimeout 是向一个副本结点推送数据的最长时间
+const pushTimeout = 3 * time.Second
+
+//defaultHotSample 表示默认每 10 个从远程结点获取的数据中抽取 1 个放入 hotCache
+const defaultHotSample = 10
+
 var (
 	mu sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g := newGroup(name, cacheBytes, getter, opts...)
+	mu.Lock()
+	defer mu.Unlock()
+
+	groups[name] = g
+	return g
+}
+
+//newGroup 创建一个不注册到全局 groups 中的 Group，便于在同一进程内模拟多个结点
+func newGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
 
 	g := &Group{
 		name: name,
 		getter: getter,
 		mainCache: cache{cacheBytes: cacheBytes},
+		hotCache: cache{cacheBytes: cacheBytes / 8},
+		hotSample: defaultHotSample,
+		loadTimeout: defaultLoadTimeout,
 		loader: &singleflight.Group{},
 	}
-
-	groups[name] = g
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.ttl > 0 {
+		g.mainCache.startJanitor(g.ttl)
+		g.hotCache.startJanitor(g.ttl)
+	}
 	return g
 }
 
+// Close 停止 Group 的后台 janitor，之后 Group 仍然可以使用，但过期数据只在读取时删除。可以重复调用
+func (g *Group) Close() {
+	g.mainCache.stopJanitor()
+	g.hotCache.stopJanitor()
+}
+
 func GetGroup(name string) *Group {
-	fmt.Println("func GetGroup(name string) *Group")
 	mu.RLock()
 	g := groups[name]
 	mu.RUnlock()
 	return g
 }
 
+//allGroups 返回所有已注册的 Group
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, g)
+	}
+	return res
+}
+
 // Get 根据 key 从缓存中取出 value
 func (g *Group) Get (key string) (ByteView, error) {
-	fmt.Println("func (g *Group) Get (key string) (ByteView, error)")
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，但在 ctx 超时或被取消时立即返回 ctx.Err()
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
-	if v, ok := g.mainCache.get(key); ok {
+	g.stats.Gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
 		log.Println("[GeeCache] hit")
+		g.stats.CacheHits.Add(1)
 		return v, nil
 	}
 
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+//lookupCache 依次查找 mainCache 和 hotCache
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, true
+	}
+	if g.hotCache.cacheBytes <= 0 {
+		return ByteView{}, false
+	}
+	return g.hotCache.get(key)
 }
 
+//CacheType 表示 Group 中的某个 cache
+type CacheType int
+
+const (
+	//MainCache 保存本结点负责的 key
+	MainCache CacheType = iota + 1
+	//HotCache 保存从远程结点获取的热点数据
+	HotCache
+)
+
+// CacheStats 返回 which 对应 cache 的统计信息
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+
+// Remove 删除 key 对应的缓存，如果 key 属于其他结点，还会通知该结点一并删除
+// 注意其他结点 hotCache 中的副本不会被删除，只能等待其被淘汰或者过期
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	g.removeLocally(key)
+	//开启副本时 key 可能缓存在每一个副本结点上，都要删除
+	if picker, ok := g.peers.(ReplicaPicker); ok && g.replicas > 1 {
+		var firstErr error
+		for _, peer := range picker.PickReplicas(key, g.replicas) {
+			if peer == nil {
+				continue
+			}
+			if err := g.removeFromPeer(peer, key); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			return g.removeFromPeer(peer, key)
+		}
+	}
+	return nil
+}
+
+//removeLocally 只删除本结点上的缓存，供远程结点的删除请求调用，避免请求在结点间来回转发
+func (g *Group) removeLocally(key string) bool {
+	hot := g.hotCache.remove(key)
+	return g.mainCache.remove(key) || hot
+}
+
+func (g *Group) removeFromPeer(peer PeerGetter, key string) error {
+	remover, ok := peer.(PeerRemover)
+	if !ok {
+		return fmt.Errorf("peer does not support remove")
+	}
+	req := &pb.Request{
+		Group: g.name,
+		Key: key,
+	}
+	return remover.Remove(req, &pb.RemoveResponse{})
+}
+
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	value, err := g.callGetter(ctx, key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.populateCache(key, value)
+	return value, nil
+}
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	fmt.Println("func (g *Group) getLocally(key string) (ByteView, error)")
-	bytes, err := g.getter.Get(key)
+//callGetter 通过 Getter 加载 key，但不放入缓存
+func (g *Group) callGetter(ctx context.Context, key string) (ByteView, error) {
+	defer g.localLatency.since(time.Now())
+	var bytes []byte
+	var err error
+	if getter, ok := g.getter.(ContextGetter); ok {
+		bytes, err = getter.GetContext(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		g.stats.LocalLoadErrs.Add(1)
 		return ByteView{}, err
 	}
+	g.stats.LocalLoads.Add(1)
 
 	value := ByteView{
 		b: cloneBytes(bytes),
 	}
-	g.populateCache(key, value)
 	return value, nil
 }
 
 func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+	g.mainCache.addWithExpiry(key, value, g.expire())
+}
+
+//populateHotCache 对从远程结点获取的数据进行抽样，被抽中的放入 hotCache
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hotCache.cacheBytes <= 0 {
+		return
+	}
+	if g.hotSample > 1 && rand.Intn(g.hotSample) != 0 {
+		return
+	}
+	g.hotCache.addWithExpiry(key, value, g.expire())
+}
+
+//expire 根据默认过期时间计算新数据的过期时刻
+func (g *Group) expire() time.Time {
+	if g.ttl > 0 {
+		return time.Now().Add(g.ttl)
+	}
+	return time.Time{}
 }
 
 //RegisterPeers 函数注册一个 PeerPicker 来选择远程的peer,实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中。
 func (g *Group) RegisterPeers(peers PeerPicker) {
-	fmt.Println("func (g *Group) RegisterPeers(peers PeerPicker)")
 	if g.peers != nil {
 		panic("Register PeerPicker called more than once")
 	}
 	g.peers = peers
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	fmt.Println("func (g *Group) load(key string) (value ByteView, err error)")
-	//将原本的 load 方法赋给 Do 的 fn 函数，当 Do 条件满足时就会调用 fn 获取结果
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
+//detachedContext 保留 ctx 中的值(例如 fromPeer 标记)，但没有截止时间，也不会随 ctx 取消
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+//loadContext 返回 singleflight 中共享的加载使用的 ctx：加载的结果会交给所有等待者，
+//如果直接使用发起加载的调用者的 ctx，它取消之后其他等待者也会收到同样的错误。所以只保留 ctx 中的值和截止时间，
+//不随 ctx 取消，截止时间最晚为 g.loadTimeout 之后，这样远程结点传来的截止时间也会传给 Getter
+func (g *Group) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(g.loadTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return context.WithDeadline(detachedContext{ctx}, deadline)
+}
+
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	//将原本的 load 方法赋给 DoContext 的 fn 函数，当 DoContext 条件满足时就会调用 fn 获取结果
+	//fn 在单独的 goroutine 中执行，所以不能直接修改命名返回值 value 和 err
+	g.stats.Loads.Add(1)
+	viewi, err := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		ctx, cancel := g.loadContext(ctx)
+		defer cancel()
+		g.stats.LoadsDeduped.Add(1)
+		if picker, ok := g.peers.(ReplicaPicker); ok && g.replicas > 1 {
+			return g.loadReplicated(ctx, picker, key)
+		}
+		if g.peers != nil && !fromPeer(ctx) {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				var value ByteView
+				var err error
+				if g.hedgeDelay > 0 {
+					value, err = g.getHedged(ctx, peer, key)
+				} else {
+					value, err = g.getFromPeer(ctx, peer, key)
+				}
+				if err == nil {
 					return value, nil
 				}
 				log.Println("[GeeCache] failed to get from peer", err)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return g.loadFailover(ctx, key, []PeerGetter{peer}, err)
+			}
+			//key 交给了自己，计入本结点的负载
+			if tracker, ok := g.peers.(localLoadTracker); ok {
+				defer tracker.startLocal()()
 			}
 		}
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
 
 	if err == nil {
@@ -123,6 +425,218 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+//loadReplicated 依次从 key 的主结点和副本结点获取数据，轮到自己或者所有结点都失败时通过 Getter 加载。
+//自己也保存 key 时，从其他结点获取的数据同样放入 mainCache。来自其他结点的请求直接通过 Getter 加载。
+//请求主结点时与 load 一样可以发出对冲请求，所有副本都失败之后按照 g.failover 继续尝试后续的结点
+func (g *Group) loadReplicated(ctx context.Context, picker ReplicaPicker, key string) (ByteView, error) {
+	owners := picker.PickReplicas(key, g.replicas)
+	owned := false
+	for _, peer := range owners {
+		if peer == nil {
+			owned = true
+		}
+	}
+
+	var lastErr error
+	for i, peer := range owners {
+		if peer == nil || fromPeer(ctx) {
+			break
+		}
+		var value ByteView
+		var err error
+		if i == 0 && g.hedgeDelay > 0 {
+			value, err = g.getHedged(ctx, peer, key)
+		} else {
+			value, err = g.getFromPeer(ctx, peer, key)
+		}
+		if err == nil {
+			if i > 0 {
+				g.stats.ReplicaLoads.Add(1)
+			}
+			if owned {
+				g.populateCache(key, value)
+			}
+			return value, nil
+		}
+		log.Println("[GeeCache] failed to get from replica", err)
+		if ctx.Err() != nil {
+			return ByteView{}, ctx.Err()
+		}
+		lastErr = err
+	}
+	if !owned && lastErr != nil {
+		return g.loadFailover(ctx, key, owners, lastErr)
+	}
+
+	value, err := g.getLocally(ctx, key)
+	if err == nil && owned && g.pushReplicas {
+		g.pushToReplicas(owners, key, value)
+	}
+	return value, err
+}
+
+//hedgeResult 是 getHedged 中一个请求的结果
+type hedgeResult struct {
+	value ByteView
+	err   error
+	hedge bool //是否是对冲请求的结果
+}
+
+//getHedged 从 peer 获取 key，超过 g.hedgeDelay 没有响应时发出对冲请求，返回最先成功的结果并取消另一个请求。
+//peer 在发出对冲请求之前就失败时直接返回其错误，交给 loadFailover 处理
+func (g *Group) getHedged(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	//容量为 2，输掉的请求返回时不会阻塞
+	results := make(chan hedgeResult, 2)
+	go func() {
+		value, err := g.getFromPeer(ctx, peer, key)
+		results <- hedgeResult{value: value, err: err}
+	}()
+	timer := time.NewTimer(g.hedgeDelay)
+	defer timer.Stop()
+
+	pending, hedged := 1, false
+	var peerErr error
+	for {
+		select {
+		case <-timer.C:
+			hedged = true
+			pending++
+			g.stats.HedgesSent.Add(1)
+			go func() {
+				value, err := g.hedge(ctx, peer, key)
+				results <- hedgeResult{value: value, err: err, hedge: true}
+			}()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.hedge {
+					g.stats.HedgesWon.Add(1)
+				}
+				return res.value, nil
+			}
+			if !res.hedge {
+				peerErr = res.err
+			}
+			if !hedged {
+				return ByteView{}, res.err
+			}
+			if pending == 0 {
+				return ByteView{}, peerErr
+			}
+		case <-ctx.Done():
+			return ByteView{}, ctx.Err()
+		}
+	}
+}
+
+//hedge 发出对冲请求：开启副本时请求 key 除 primary 以外的第一个副本结点，副本是自己时在本结点加载并放入缓存；
+//其他结点上没有 key 的副本，请求它们只会让它们再去加载一次，所以没有可用的副本时在本结点通过 Getter 加载，不放入 mainCache
+func (g *Group) hedge(ctx context.Context, primary PeerGetter, key string) (ByteView, error) {
+	if picker, ok := g.peers.(ReplicaPicker); ok && g.replicas > 1 {
+		for _, peer := range picker.PickReplicas(key, g.replicas) {
+			if peer == primary {
+				continue
+			}
+			if peer == nil {
+				return g.getLocally(ctx, key)
+			}
+			return g.getFromPeer(ctx, peer, key)
+		}
+	}
+	return g.callGetter(ctx, key)
+}
+
+//loadFailover 在从 key 所属的结点以及副本结点 tried 获取失败之后，按照 g.failover 依次尝试哈希环上后续的 NextPeers 个结点，
+//err 是最后一个结点返回的错误。后续结点是自己时，key 在所属结点恢复之前就由自己负责，在本结点加载并放入 mainCache
+func (g *Group) loadFailover(ctx context.Context, key string, tried []PeerGetter, err error) (ByteView, error) {
+	value, self, err := g.tryNextPeers(ctx, key, tried, err)
+	switch {
+	case self:
+		value, err = g.getLocally(ctx, key)
+		if err == nil {
+			g.stats.FailoverLoads.Add(1)
+		}
+		return value, err
+	case err == nil:
+		return value, nil
+	case ctx.Err() != nil:
+		return ByteView{}, ctx.Err()
+	}
+	return g.fallbackLocally(ctx, key, err)
+}
+
+//tryNextPeers 按照 g.failover 依次从哈希环上 tried 之后的 NextPeers 个结点获取 key，成功时返回的 error 为 nil。
+//轮到自己时停止尝试并返回 true，由调用者在本结点加载；所有结点都失败时返回最后一个错误，err 是 tried 返回的错误
+func (g *Group) tryNextPeers(ctx context.Context, key string, tried []PeerGetter, err error) (ByteView, bool, error) {
+	picker, ok := g.peers.(ReplicaPicker)
+	if !ok || g.failover.NextPeers <= 0 {
+		return ByteView{}, false, err
+	}
+	for _, peer := range picker.PickReplicas(key, len(tried)+g.failover.NextPeers) {
+		if containsPeer(tried, peer) {
+			continue
+		}
+		if peer == nil {
+			return ByteView{}, true, err
+		}
+		var value ByteView
+		value, err = g.getFromPeer(ctx, peer, key)
+		if err == nil {
+			g.stats.FailoverLoads.Add(1)
+			return value, false, nil
+		}
+		log.Println("[GeeCache] failed to get from next peer", err)
+		if ctx.Err() != nil {
+			return ByteView{}, false, ctx.Err()
+		}
+	}
+	return ByteView{}, false, err
+}
+
+func containsPeer(peers []PeerGetter, peer PeerGetter) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+//fallbackLocally 在所有远程结点都失败之后加载不属于本结点的 key，err 是最后一个远程结点返回的错误
+func (g *Group) fallbackLocally(ctx context.Context, key string, err error) (ByteView, error) {
+	if g.failover.FailFast {
+		return ByteView{}, fmt.Errorf("failed to get %s from peers: %w", key, err)
+	}
+	if g.failover.SkipCache {
+		return g.callGetter(ctx, key)
+	}
+	return g.getLocally(ctx, key)
+}
+
+//pushToReplicas 在后台把 value 推送给 owners 中的远程结点，失败时只记录日志，缺少副本的结点之后会自己加载
+func (g *Group) pushToReplicas(owners []PeerGetter, key string, value ByteView) {
+	req := &pb.Request{
+		Group: g.name,
+		Key: key,
+	}
+	for _, peer := range owners {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+			defer cancel()
+			if err := setter.Set(ctx, req, &pb.Response{Value: value.ByteSlice()}); err != nil {
+				log.Println("[GeeCache] failed to push to replica", err)
+			}
+		}()
+	}
+}
+
 // 未使用gRPC的getFromPeer
 //func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 //	bytes, err := peer.Get(g.name, key)
@@ -132,19 +646,31 @@ func (g *Group) load(key string) (value ByteView, err error) {
 //	return ByteView{b: bytes}, nil
 //}
 
-// 使用了gRPC的getFromPeer
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	fmt.Println("func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error)")
+// 使用了gRPC的getFromPeer，peer 实现了 ContextPeerGetter 时会把 ctx 的截止时间一并传给远程结点
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key: key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	defer g.peerLatency.since(time.Now())
+	var err error
+	if getter, ok := peer.(ContextPeerGetter); ok {
+		err = getter.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
+		//请求方取消的请求不代表远程结点出错
+		if !errors.Is(err, context.Canceled) {
+			g.stats.PeerErrors.Add(1)
+		}
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	g.stats.PeerLoads.Add(1)
+	value := ByteView{b: res.Value}
+	g.populateHotCache(key, value)
+	return value, nil
 }
 
 
@@ -1,10 +1,21 @@
 package geecache
 
 import (
+	"cache/geecache/consistenthash"
+	"cache/geecache/pb"
+	"cache/geecache/placement"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -52,4 +63,1148 @@ func TestGet(t *testing.T) {
 	if view, err := gee.Get("unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetWithTTL(t *testing.T) {
+	loads := 0
+	gee := NewGroup("ttl", 2 << 10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithTTL(50 * time.Millisecond))
+	defer gee.Close()
+
+	for i := 0; i < 2; i++ {
+		if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+			t.Fatal("failed to get value of Tom")
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("Tom should be loaded once before expiry, got %d", loads)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := gee.mainCache.get("Tom"); ok {
+		t.Fatal("Tom should have expired")
+	}
+	if _, err := gee.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("Tom should be reloaded after expiry, got %d loads", loads)
+	}
+
+	//没有读写时 janitor 也会清理不再被访问的过期数据
+	evictions := gee.CacheStats(MainCache).Evictions
+	time.Sleep(150 * time.Millisecond)
+	if s := gee.CacheStats(MainCache); s.Items != 0 || s.Evictions != evictions+1 {
+		t.Fatalf("the janitor should remove expired Tom, got %+v", s)
+	}
+
+	//Close 之后 janitor 停止，过期数据只在读取时删除
+	gee.Close()
+	gee.Close()
+	gee.Get("Jack")
+	time.Sleep(150 * time.Millisecond)
+	if n := gee.CacheStats(MainCache).Items; n != 1 {
+		t.Fatalf("the janitor should be stopped after Close, %d items left", n)
+	}
+}
+
+//testNode 是进程内模拟的一个缓存结点
+type testNode struct {
+	pool   *HTTPPool
+	group  *Group
+	server *httptest.Server
+}
+
+//startTestCluster 在进程内启动 n 个结点，每个结点拥有各自同名的 Group
+func startTestCluster(t *testing.T, n int, name string, getter Getter, opts ...GroupOption) []*testNode {
+	nodes := make([]*testNode, n)
+	addrs := make([]string, n)
+	for i := range nodes {
+		node := &testNode{}
+		node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node.pool.ServeHTTP(w, r)
+		}))
+		t.Cleanup(node.server.Close)
+		node.group = newGroup(name, 2 << 10, getter, opts...)
+		node.pool = NewHTTPPoolOpts(node.server.URL, &HTTPPoolOptions{AdminToken: testAdminToken})
+		node.pool.getGroup = func(groupName string) *Group {
+			if groupName == node.group.name {
+				return node.group
+			}
+			return nil
+		}
+		nodes[i] = node
+		addrs[i] = node.server.URL
+	}
+	for _, node := range nodes {
+		node.pool.Set(addrs...)
+		node.group.RegisterPeers(node.pool)
+	}
+	return nodes
+}
+
+//owner 返回 key 在一致性哈希环上所属的结点，以及任意一个不拥有 key 的结点
+func owner(nodes []*testNode, key string) (own *testNode, other *testNode) {
+	addr := nodes[0].pool.peers.Get(key)
+	for _, node := range nodes {
+		if node.server.URL == addr {
+			own = node
+		} else if other == nil {
+			other = node
+		}
+	}
+	return
+}
+
+func TestRemove(t *testing.T) {
+	var mu sync.Mutex
+	source := map[string]string{"Tom": "630"}
+	loads := 0
+	nodes := startTestCluster(t, 3, "remove", GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			loads++
+			if v, ok := source[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	own, other := owner(nodes, "Tom")
+	if view, err := other.group.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("failed to get Tom from owner, got %q %v", view, err)
+	}
+	if _, ok := own.group.mainCache.get("Tom"); !ok {
+		t.Fatal("Tom should be cached on its owner")
+	}
+
+	mu.Lock()
+	source["Tom"] = "700"
+	mu.Unlock()
+	if err := other.group.Remove("Tom"); err != nil {
+		t.Fatalf("remove Tom failed: %v", err)
+	}
+	for _, node := range nodes {
+		if _, ok := node.group.mainCache.get("Tom"); ok {
+			t.Fatalf("Tom should be removed from %s", node.server.URL)
+		}
+	}
+
+	if view, err := other.group.Get("Tom"); err != nil || view.String() != "700" {
+		t.Fatalf("Tom should be reloaded after remove, got %q %v", view, err)
+	}
+	if loads != 2 {
+		t.Fatalf("Tom should be loaded twice, got %d", loads)
+	}
+
+	if err := other.group.Remove(""); err == nil {
+		t.Fatal("remove empty key should fail")
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	gee := NewGroup("slow", 2 << 10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			select {
+			case <-time.After(time.Second):
+				return []byte(key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); err != context.DeadlineExceeded {
+		t.Fatalf("slow getter should hit the deadline, got %v", err)
+	}
+}
+
+func TestGetContextSharedLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var loads AtomicInt
+	gee := newGroup("shared", 2 << 10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			loads.Add(1)
+			close(started)
+			select {
+			case <-release:
+				return []byte(key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+
+	//第一个调用者发起加载之后取消
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := gee.GetContext(first, "Tom")
+		firstErr <- err
+	}()
+	<-started
+
+	//第二个调用者等待同一次加载
+	second := make(chan error, 1)
+	go func() {
+		v, err := gee.GetContext(context.Background(), "Tom")
+		if err == nil && v.String() != "Tom" {
+			err = fmt.Errorf("unexpected value %q", v.String())
+		}
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Fatalf("the first caller should see its own cancellation, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("the second caller should get the value, got %v", err)
+	}
+	if loads.Get() != 1 {
+		t.Fatalf("the key should be loaded once, got %d", loads.Get())
+	}
+}
+
+func TestGetContextFromPeer(t *testing.T) {
+	deadlines := make(chan time.Time, 1)
+	nodes := startTestCluster(t, 3, "slowpeer", ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+
+	_, other := owner(nodes, "Tom")
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	start := time.Now()
+	if _, err := other.group.GetContext(ctx, "Tom"); err == nil {
+		t.Fatal("get from slow peer should fail")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("get from slow peer should return once the deadline is exceeded")
+	}
+	//所属结点的 Getter 使用请求方的截止时间，而不是 loadTimeout
+	if got := <-deadlines; got.Before(want.Add(-50*time.Millisecond)) || got.After(want.Add(50*time.Millisecond)) {
+		t.Fatalf("the owner's Getter should see a deadline near %v, got %v", want, got)
+	}
+}
+
+//batchGetter 记录每个结点上 Getter 的调用次数
+type batchGetter struct {
+	mu      sync.Mutex
+	gets    int
+	batches [][]string
+}
+
+func (b *batchGetter) Get(key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gets++
+	if v, ok := db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s not exist", key)
+}
+
+func (b *batchGetter) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, keys)
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	getter := &batchGetter{}
+	nodes := startTestCluster(t, 3, "multi", getter)
+
+	keys := []string{"unknown", ""}
+	for k := range db {
+		keys = append(keys, k, k)
+	}
+	views, err := nodes[0].group.GetMulti(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != len(db) {
+		t.Fatalf("expect %d values, got %d", len(db), len(views))
+	}
+	for k, v := range db {
+		if views[k].String() != v {
+			t.Fatalf("%s should be %s, got %s", k, v, views[k])
+		}
+		own, _ := owner(nodes, k)
+		if _, ok := own.group.mainCache.get(k); !ok {
+			t.Fatalf("%s should be cached on its owner", k)
+		}
+	}
+	if getter.gets != 0 {
+		t.Fatalf("keys should be loaded in batches, got %d single gets", getter.gets)
+	}
+	loaded := 0
+	for _, batch := range getter.batches {
+		loaded += len(batch)
+	}
+	if len(getter.batches) > len(nodes) || loaded != len(db) + 1 {
+		t.Fatalf("each node should load its keys in one batch, got %v", getter.batches)
+	}
+	//每次批量加载或批量请求只算一次实际的加载：nodes[0] 向每个远程结点发送一次请求，自己的 key 加载一次
+	if n := nodes[0].group.Stats().LoadsDeduped; int(n) != len(getter.batches) {
+		t.Fatalf("expected %d loads to run on the first node, got %d", len(getter.batches), n)
+	}
+	for _, node := range nodes[1:] {
+		if s := node.group.Stats(); s.LoadsDeduped != s.ServerRequests {
+			t.Fatalf("each batch request should run one load, got %+v", s)
+		}
+	}
+
+	getter.batches = nil
+	if _, err := nodes[1].group.GetMulti(keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range getter.batches {
+		if len(batch) != 1 || batch[0] != "unknown" {
+			t.Fatalf("cached keys should not be loaded again, got %v", getter.batches)
+		}
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	nodes := startTestCluster(t, 3, "hot", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+
+	own, other := owner(nodes, "Tom")
+	other.group.hotSample = 1
+	for i := 0; i < 3; i++ {
+		if view, err := other.group.Get("Tom"); err != nil || view.String() != "Tom" {
+			t.Fatalf("failed to get Tom, got %q %v", view, err)
+		}
+	}
+	if _, ok := other.group.mainCache.get("Tom"); ok {
+		t.Fatal("Tom is owned by another peer and should not be in mainCache")
+	}
+	hot := other.group.CacheStats(HotCache)
+	if hot.Hits != 2 || hot.Items != 1 {
+		t.Fatalf("Tom should be served from hotCache, got %+v", hot)
+	}
+	if main := own.group.CacheStats(MainCache); main.Hits != 0 || main.Items != 1 {
+		t.Fatalf("owner should load Tom once, got %+v", main)
+	}
+
+	//hotCache 的内存上限只够保存一条数据
+	other.group.hotCache = cache{cacheBytes: int64(len("key0") * 2)}
+	for i := 0; i < 10; i++ {
+		if _, err := other.group.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hot := other.group.CacheStats(HotCache); hot.Items > 1 || hot.Evictions == 0 {
+		t.Fatalf("hotCache should evict with its own budget, got %+v", hot)
+	}
+}
+
+
+func TestStats(t *testing.T) {
+	nodes := startTestCluster(t, 3, "stats", GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	own, other := owner(nodes, "Tom")
+	other.group.hotSample = 1
+	for i := 0; i < 2; i++ {
+		if _, err := other.group.Get("Tom"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := other.group.Stats()
+	if stats.Gets != 2 || stats.CacheHits != 1 || stats.PeerLoads != 1 || stats.HotCache.Hits != 1 {
+		t.Fatalf("unexpected stats on %s: %+v", other.server.URL, stats)
+	}
+	stats = own.group.Stats()
+	if stats.ServerRequests != 1 || stats.LocalLoads != 1 || stats.MainCache.Items != 1 {
+		t.Fatalf("unexpected stats on owner %s: %+v", own.server.URL, stats)
+	}
+
+	res, err := http.Get(own.server.URL + "/_stats?group=stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got []GroupStats
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], own.group.Stats()) {
+		t.Fatalf("/_stats returned %+v, expect %+v", got, own.group.Stats())
+	}
+}
+
+func TestStatsLoadsDeduped(t *testing.T) {
+	release := make(chan struct{})
+	gee := newGroup("dedupe", 2 << 10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gee.Get("Tom")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	stats := gee.Stats()
+	if stats.Loads != 5 || stats.LoadsDeduped != 1 || stats.LocalLoads != 1 {
+		t.Fatalf("concurrent loads should be deduped, got %+v", stats)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	nodes := startTestCluster(t, 3, "metrics", GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	_, other := owner(nodes, "Tom")
+	other.group.hotSample = 1
+	for i := 0; i < 2; i++ {
+		other.group.Get("Tom")
+	}
+	//找到一个属于 other 且不存在的 key，使本地加载失败一次
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("unknown%d", i)
+		if own, _ := owner(nodes, key); own == other {
+			other.group.Get(key)
+			break
+		}
+	}
+
+	var buf strings.Builder
+	if err := writeMetrics(&buf, []*Group{other.group}, other.pool.peerStats); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	expect := []string{
+		"# TYPE geecache_gets_total counter",
+		"# TYPE geecache_load_duration_seconds histogram",
+		"geecache_local_load_errors_total{group=\"metrics\"} 1",
+		"geecache_load_duration_seconds_count{group=\"metrics\",source=\"peer\"} 1",
+		"geecache_load_duration_seconds_bucket{group=\"metrics\",source=\"local\",le=\"+Inf\"} 1",
+		"geecache_cache_items{group=\"metrics\",cache=\"hot\"} 1",
+		"geecache_gets_total{group=\"metrics\"} 3",
+		"geecache_peer_requests_total{peer=\"" + nodes[0].pool.peers.Get("Tom") + "\"} 1",
+	}
+	for _, line := range expect {
+		if !strings.Contains(out, line + "\n") {
+			t.Errorf("metrics should contain %q, got:\n%s", line, out)
+		}
+	}
+
+	if got := formatLabels([]string{"peer", "a\"b\\c\nd"}); got != `{peer="a\"b\\c\nd"}` {
+		t.Fatalf("label should be escaped, got %s", got)
+	}
+
+	w := httptest.NewRecorder()
+	other.pool.ServeMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("/metrics returned %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+
+func TestListenSentinel(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+
+	send := func(event string) {
+		body := fmt.Sprintf(`{"peer_name":"http://localhost:8002","event":%q}`, event)
+		w := httptest.NewRecorder()
+		pool.ListenSentinel(w, httptest.NewRequest(http.MethodPut, "/sentinel", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("sentinel message returned %d", w.Code)
+		}
+	}
+	picked := func() bool {
+		for i := 0; i < 100; i++ {
+			if peer, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok && peer.(*httpGetter).baseURL == "http://localhost:8002" + defaultBasePath {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !picked() {
+		t.Fatal("8002 should own some keys")
+	}
+	send("down")
+	if picked() {
+		t.Fatal("8002 should be removed from the ring")
+	}
+	send("up")
+	send("up")
+	if !picked() || len(pool.httpGetters) != 3 {
+		t.Fatal("8002 should be added back to the ring once")
+	}
+
+	w := httptest.NewRecorder()
+	pool.ListenSentinel(w, httptest.NewRequest(http.MethodPut, "/sentinel", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed sentinel message should be rejected, got %d", w.Code)
+	}
+}
+
+func TestAdminPeers(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{AdminToken: "secret"})
+	pool.Set("http://localhost:8001", "http://localhost:8002")
+
+	do := func(method, target, body string, code int) Membership {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		pool.ServeAdminPeers(w, req)
+		if w.Code != code {
+			t.Fatalf("%s %s returned %d, want %d: %s", method, target, w.Code, code, w.Body.String())
+		}
+		m := Membership{}
+		if code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return m
+	}
+
+	m := do(http.MethodGet, "/_admin/peers", "", http.StatusOK)
+	if !reflect.DeepEqual(m.Peers, []string{"http://localhost:8001", "http://localhost:8002"}) || m.Epoch != 1 {
+		t.Fatalf("unexpected membership %+v", m)
+	}
+
+	m = do(http.MethodPost, "/_admin/peers?peer=http://localhost:8003", "", http.StatusOK)
+	if len(m.Peers) != 3 || m.Epoch != 2 {
+		t.Fatalf("8003 should be added, got %+v", m)
+	}
+	//重复添加不会改变哈希环，epoch 也不变
+	m = do(http.MethodPost, "/_admin/peers", `{"peers":["http://localhost:8003"]}`, http.StatusOK)
+	if len(m.Peers) != 3 || m.Epoch != 2 {
+		t.Fatalf("adding 8003 twice should not change the ring, got %+v", m)
+	}
+	if _, ok := pool.httpGetters["http://localhost:8003"]; !ok {
+		t.Fatal("8003 should have a getter")
+	}
+
+	m = do(http.MethodDelete, "/_admin/peers", `{"peers":["http://localhost:8002","http://localhost:8003"]}`, http.StatusOK)
+	if !reflect.DeepEqual(m.Peers, []string{"http://localhost:8001"}) || m.Epoch != 3 {
+		t.Fatalf("8002 and 8003 should be removed in one epoch, got %+v", m)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			t.Fatal("only self should be left on the ring")
+		}
+	}
+
+	do(http.MethodPost, "/_admin/peers", "", http.StatusBadRequest)
+	do(http.MethodPost, "/_admin/peers?peer=localhost:8004", "", http.StatusBadRequest)
+	do(http.MethodPost, "/_admin/peers", "{", http.StatusBadRequest)
+	do(http.MethodPut, "/_admin/peers", "", http.StatusMethodNotAllowed)
+}
+
+func TestAdminPeersAuth(t *testing.T) {
+	request := func(pool *HTTPPool, auth string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/_admin/peers?peer=http://localhost:8003", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		pool.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	//没有配置令牌时关闭管理接口
+	open := NewHTTPPool("http://localhost:8001")
+	open.Set("http://localhost:8001", "http://localhost:8002")
+	if code := request(open, "Bearer "); code != http.StatusForbidden {
+		t.Fatalf("admin API without a token should be disabled, got %d", code)
+	}
+
+	pool := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{AdminToken: "secret"})
+	pool.Set("http://localhost:8001", "http://localhost:8002")
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic secret"} {
+		if code := request(pool, auth); code != http.StatusUnauthorized {
+			t.Fatalf("Authorization %q should be rejected, got %d", auth, code)
+		}
+	}
+	if m := pool.Membership(); len(m.Peers) != 2 || len(open.Membership().Peers) != 2 {
+		t.Fatal("unauthorized requests should not change the ring")
+	}
+	if code := request(pool, "Bearer secret"); code != http.StatusOK {
+		t.Fatalf("authorized request should succeed, got %d", code)
+	}
+}
+
+func TestListenSentinelEpoch(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+
+	send := func(peer, event string, epoch uint64) int {
+		body := fmt.Sprintf(`{"peer_name":%q,"event":%q,"epoch":%d}`, peer, event, epoch)
+		w := httptest.NewRecorder()
+		pool.ListenSentinel(w, httptest.NewRequest(http.MethodPut, "/sentinel", strings.NewReader(body)))
+		return w.Code
+	}
+
+	//8002 下线后又恢复，延迟到达的下线消息不能再把它删除
+	if code := send("http://localhost:8002", "down", 10); code != http.StatusOK {
+		t.Fatalf("down returned %d", code)
+	}
+	if code := send("http://localhost:8002", "up", 20); code != http.StatusOK {
+		t.Fatalf("up returned %d", code)
+	}
+	if code := send("http://localhost:8002", "down", 10); code != http.StatusConflict {
+		t.Fatalf("stale down should be rejected, got %d", code)
+	}
+	//收到过带 epoch 的消息之后，不带 epoch 的消息也不能覆盖
+	if code := send("http://localhost:8002", "down", 0); code != http.StatusConflict {
+		t.Fatalf("down without an epoch should be rejected after epoch 20, got %d", code)
+	}
+	if _, ok := pool.httpGetters["http://localhost:8002"]; !ok {
+		t.Fatal("8002 should still be on the ring")
+	}
+	//从未收到过带 epoch 的消息的结点仍然接受旧版哨兵的消息
+	if code := send("http://localhost:8004", "up", 0); code != http.StatusOK {
+		t.Fatalf("up without an epoch for a new peer returned %d", code)
+	}
+
+	//epoch 是按结点记录的，其他结点较小的 epoch 依然生效
+	if code := send("http://localhost:8003", "down", 15); code != http.StatusOK {
+		t.Fatalf("down for 8003 returned %d", code)
+	}
+	if _, ok := pool.httpGetters["http://localhost:8003"]; ok {
+		t.Fatal("8003 should be removed")
+	}
+
+	m := pool.Membership()
+	want := map[string]uint64{"http://localhost:8002": 20, "http://localhost:8003": 15}
+	if len(m.Peers) != 3 {
+		t.Fatalf("8001, 8002 and 8004 should be on the ring, got %v", m.Peers)
+	}
+	if m.SentinelEpoch != 20 || !reflect.DeepEqual(m.PeerEpochs, want) {
+		t.Fatalf("unexpected epochs %+v", m)
+	}
+}
+
+func TestSetWeighted(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.SetWeighted(map[string]int{"http://localhost:8001": 1, "http://localhost:8002": 4})
+	if pool.peers.(*consistenthash.Map).Weight("http://localhost:8002") != 4 || len(pool.httpGetters) != 2 {
+		t.Fatal("8002 should be on the ring with weight 4")
+	}
+
+	remote := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			remote++
+		}
+	}
+	if remote <= 500 {
+		t.Fatalf("8002 has 4 times the weight of 8001 but only owns %d of 1000 keys", remote)
+	}
+
+	//哨兵通知下线又恢复之后，以及手动删除再添加之后，结点保持原来的权重
+	for i, event := range []string{"down", "up"} {
+		body := fmt.Sprintf(`{"peer_name":"http://localhost:8002","event":%q,"epoch":%d}`, event, i+1)
+		pool.ListenSentinel(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/sentinel", strings.NewReader(body)))
+	}
+	if w := pool.peers.(*consistenthash.Map).Weight("http://localhost:8002"); w != 4 {
+		t.Fatalf("8002 should be re-admitted with weight 4, got %d", w)
+	}
+	pool.RemovePeer("http://localhost:8002")
+	pool.AddPeer("http://localhost:8002", "http://localhost:8003")
+	ring := pool.peers.(*consistenthash.Map)
+	if ring.Weight("http://localhost:8002") != 4 || ring.Weight("http://localhost:8003") != 1 {
+		t.Fatalf("8002 should keep weight 4 and a new peer gets weight 1, got %d and %d",
+			ring.Weight("http://localhost:8002"), ring.Weight("http://localhost:8003"))
+	}
+}
+
+func TestSetPlacement(t *testing.T) {
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	ring := NewHTTPPool(peers[0])
+	ring.Set(peers...)
+	pool := NewHTTPPool(peers[0])
+	pool.SetPlacement(func() placement.Placement { return placement.NewRendezvous() })
+	pool.Set(peers...)
+	if _, ok := pool.peers.(*placement.Rendezvous); !ok {
+		t.Fatalf("expected rendezvous placement, got %T", pool.peers)
+	}
+
+	//两种算法都会选中远程结点，但结果不同
+	remote, differ := 0, 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if _, ok := pool.PickPeer(key); ok {
+			remote++
+		}
+		if pool.peers.Get(key) != ring.peers.Get(key) {
+			differ++
+		}
+	}
+	if remote < 500 || differ == 0 {
+		t.Fatalf("rendezvous picked %d remote peers, differs from the ring on %d keys", remote, differ)
+	}
+
+	//不支持有界负载的算法忽略 SetBoundedLoad
+	pool.SetBoundedLoad(0.25)
+	pool.statsOf(peers[1]).inflight.Add(10)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		peer, ok := pool.PickPeer(key)
+		if owner := pool.peers.Get(key); owner != peers[0] && (!ok || peer.(*httpGetter).baseURL != owner+defaultBasePath) {
+			t.Fatalf("%s should still go to its owner %s", key, owner)
+		}
+	}
+}
+
+func TestSetPlacementOrder(t *testing.T) {
+	peers := make([]string, 8)
+	for i := range peers {
+		peers[i] = fmt.Sprintf("http://localhost:%d", 8001+i)
+	}
+	for _, name := range placement.Names {
+		name := name
+		newPool := func() *HTTPPool {
+			pool := NewHTTPPool(peers[0])
+			pool.SetPlacement(func() placement.Placement {
+				p, _ := placement.New(name, defaultReplicas)
+				return p
+			})
+			pool.Set(peers...)
+			return pool
+		}
+		agree := func(a, b *HTTPPool, when string) {
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key%d", i)
+				if a.peers.Get(key) != b.peers.Get(key) {
+					t.Fatalf("%s: pools disagree on %s %s", name, key, when)
+				}
+			}
+		}
+		//SetWeighted 遍历 map 的顺序是随机的，两个结点仍然要得到相同的映射
+		a, b := newPool(), newPool()
+		agree(a, b, "after Set")
+
+		//哨兵通知结点下线又恢复之后，与一直没有变化的结点得到相同的映射
+		a.RemovePeer(peers[2])
+		a.AddPeer(peers[2])
+		agree(a, b, "after removing and adding back "+peers[2])
+
+		//结点以不同的顺序加入
+		a.RemovePeer(peers[3], peers[5])
+		b.RemovePeer(peers[3], peers[5])
+		a.AddPeer(peers[3], peers[5])
+		b.AddPeer(peers[5], peers[3])
+		agree(a, b, "after adding peers in different orders")
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	pool.SetBoundedLoad(0.25)
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if pool.peers.Get(fmt.Sprintf("key%d", i)) == "http://localhost:8002" {
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	if peer, ok := pool.PickPeer(key); !ok || peer.(*httpGetter).baseURL != "http://localhost:8002"+defaultBasePath {
+		t.Fatalf("idle 8002 should own %s", key)
+	}
+
+	//8002 上有很多未结束的请求，key 交给环上的下一个结点
+	pool.statsOf("http://localhost:8002").inflight.Add(10)
+	if peer, ok := pool.PickPeer(key); ok && peer.(*httpGetter).baseURL == "http://localhost:8002"+defaultBasePath {
+		t.Fatalf("overloaded 8002 should be skipped for %s", key)
+	}
+	pool.SetBoundedLoad(0)
+	if peer, ok := pool.PickPeer(key); !ok || peer.(*httpGetter).baseURL != "http://localhost:8002"+defaultBasePath {
+		t.Fatal("bounded load should be disabled")
+	}
+	pool.statsOf("http://localhost:8002").inflight.Add(-10)
+
+	//自己的负载与远程结点的含义相同：本结点交给自己、正在本地进行的加载
+	pool.SetBoundedLoad(0.25)
+	var self string
+	for i := 0; self == ""; i++ {
+		if pool.peers.Get(fmt.Sprintf("key%d", i)) == "http://localhost:8001" {
+			self = fmt.Sprintf("key%d", i)
+		}
+	}
+	var during int64
+	g := newGroup("bounded", 2 << 10, GetterFunc(func(key string) ([]byte, error) {
+		during = pool.localInflight.Get()
+		return []byte(key), nil
+	}))
+	g.RegisterPeers(pool)
+	if _, err := g.Get(self); err != nil || during != 1 || pool.localInflight.Get() != 0 {
+		t.Fatalf("a local load should count as load on self while it runs, got %d then %d, %v", during, pool.localInflight.Get(), err)
+	}
+	pool.localInflight.Add(10)
+	if _, ok := pool.PickPeer(self); !ok {
+		t.Fatalf("overloaded self should hand %s to another peer", self)
+	}
+}
+
+func TestFromPeerNotForwarded(t *testing.T) {
+	nodes := startTestCluster(t, 2, "scores", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	own, other := owner(nodes, "Tom")
+
+	//其他结点把 key 交给了不拥有它的结点，该结点直接加载，不再转发给 owner
+	res, err := http.Get(other.server.URL + defaultBasePath + "scores/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("server returned %v", res.Status)
+	}
+	if s := other.group.Stats(); s.LocalLoads != 1 || s.PeerLoads != 0 {
+		t.Fatalf("request from a peer should be loaded locally, got %+v", s)
+	}
+	if s := own.group.Stats(); s.ServerRequests != 0 {
+		t.Fatalf("owner should not receive a forwarded request, got %+v", s)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	//GetMulti 与 Get 一样从副本结点获取，并把数据推送给副本结点
+	for _, multi := range []bool{false, true} {
+		get := func(g *Group) (ByteView, error) {
+			if !multi {
+				return g.Get("Tom")
+			}
+			values, err := g.GetMulti([]string{"Tom"})
+			if v, ok := values["Tom"]; ok || err != nil {
+				return v, err
+			}
+			return ByteView{}, fmt.Errorf("Tom is missing")
+		}
+		for _, push := range []bool{true, false} {
+			var mu sync.Mutex
+			loads := 0
+			nodes := startTestCluster(t, 3, "replicas", GetterFunc(func(key string) ([]byte, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				loads++
+				return []byte("value of " + key), nil
+			}), WithReplication(2, push), WithHotCache(0))
+
+			byAddr := make(map[string]*testNode)
+			for _, node := range nodes {
+				byAddr[node.server.URL] = node
+			}
+			owners := nodes[0].pool.peers.(placement.ReplicatedPlacement).GetN("Tom", 2)
+			primary, replica := byAddr[owners[0]], byAddr[owners[1]]
+			var other *testNode
+			for _, node := range nodes {
+				if node != primary && node != replica {
+					other = node
+				}
+			}
+
+			//主结点从数据源加载之后把数据推送给副本结点
+			if v, err := get(other.group); err != nil || v.String() != "value of Tom" {
+				t.Fatalf("multi=%v push=%v: Get returned %q, %v", multi, push, v.String(), err)
+			}
+			if push {
+				deadline := time.Now().Add(time.Second)
+				for replica.group.CacheStats(MainCache).Items == 0 && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				if replica.group.CacheStats(MainCache).Items != 1 {
+					t.Fatal("the value should be pushed to the replica")
+				}
+			} else if replica.group.CacheStats(MainCache).Items != 0 {
+				t.Fatal("nothing should be pushed without push")
+			}
+
+			//主结点下线之后从副本结点获取，推送过的副本不需要再次加载
+			primary.server.Close()
+			if v, err := get(other.group); err != nil || v.String() != "value of Tom" {
+				t.Fatalf("multi=%v push=%v: Get after the primary is down returned %q, %v", multi, push, v.String(), err)
+			}
+			want := 2
+			if push {
+				want = 1
+			}
+			if loads != want {
+				t.Fatalf("multi=%v push=%v: expected %d loads from the source, got %d", multi, push, want, loads)
+			}
+			if s := other.group.Stats(); s.ReplicaLoads != 1 || s.LocalLoads != 0 {
+				t.Fatalf("multi=%v push=%v: the value should come from the replica, got %+v", multi, push, s)
+			}
+		}
+	}
+}
+
+func TestRemoveReplicated(t *testing.T) {
+	nodes := startTestCluster(t, 3, "removereplicas", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithReplication(2, true), WithHotCache(0))
+
+	byAddr := make(map[string]*testNode)
+	for _, node := range nodes {
+		byAddr[node.server.URL] = node
+	}
+	owners := nodes[0].pool.peers.(placement.ReplicatedPlacement).GetN("Tom", 2)
+	primary, replica := byAddr[owners[0]], byAddr[owners[1]]
+	var other *testNode
+	for _, node := range nodes {
+		if node != primary && node != replica {
+			other = node
+		}
+	}
+
+	if _, err := other.group.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for replica.group.CacheStats(MainCache).Items == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if replica.group.CacheStats(MainCache).Items != 1 {
+		t.Fatal("the value should be pushed to the replica")
+	}
+
+	//删除时主结点和副本结点上的缓存都要删除
+	if err := other.group.Remove("Tom"); err != nil {
+		t.Fatalf("remove Tom failed: %v", err)
+	}
+	for _, node := range nodes {
+		if _, ok := node.group.mainCache.get("Tom"); ok {
+			t.Fatalf("Tom should be removed from %s", node.server.URL)
+		}
+	}
+}
+
+//fakePeer 是用于测试的 PeerGetter，err 不为 nil 时总是返回 err，每个请求需要 delay 的时间
+type fakePeer struct {
+	name     string
+	err      error
+	delay    time.Duration
+	calls    AtomicInt
+	canceled AtomicInt
+}
+
+func (f *fakePeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	select {
+	case <-time.After(f.delay):
+		return f.Get(in, out)
+	case <-ctx.Done():
+		f.canceled.Add(1)
+		return ctx.Err()
+	}
+}
+
+func (f *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	f.calls.Add(1)
+	if f.err != nil {
+		return f.err
+	}
+	out.Value = []byte(f.name + ":" + in.GetKey())
+	return nil
+}
+
+//fakePicker 对所有 key 都按顺序返回 peers，nil 表示自己
+type fakePicker struct {
+	peers []PeerGetter
+}
+
+func (f *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if len(f.peers) == 0 || f.peers[0] == nil {
+		return nil, false
+	}
+	return f.peers[0], true
+}
+
+func (f *fakePicker) PickReplicas(key string, n int) []PeerGetter {
+	if n > len(f.peers) {
+		n = len(f.peers)
+	}
+	return f.peers[:n]
+}
+
+//newFakePeersGroup 创建一个从 fakePicker 选择结点的 Group，Getter 返回 "local:<key>"，
+//self 是自己在哈希环上的位置，-1 表示不在 peers 中
+func newFakePeersGroup(name string, peers []*fakePeer, self int, opts ...GroupOption) *Group {
+	opts = append(opts, WithHotCache(0))
+	g := newGroup(name, 2 << 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local:" + key), nil
+	}), opts...)
+	var ring []PeerGetter
+	for _, p := range peers {
+		if len(ring) == self {
+			ring = append(ring, nil)
+		}
+		ring = append(ring, p)
+	}
+	if len(ring) == self {
+		ring = append(ring, nil)
+	}
+	g.RegisterPeers(&fakePicker{peers: ring})
+	return g
+}
+
+func TestFailover(t *testing.T) {
+	down := errors.New("connection refused")
+	testCases := []struct {
+		name      string
+		failover  Failover
+		replicas  int
+		peers     []*fakePeer
+		self      int //自己在哈希环上的位置，-1 表示不在前几个结点中
+		want      string
+		wantErr   bool
+		wantLocal int64
+		cached    bool
+	}{
+		{"default", Failover{}, 1, []*fakePeer{{name: "a", err: down}, {name: "b"}}, -1, "local:Tom", false, 1, true},
+		{"next peer", Failover{NextPeers: 2}, 1, []*fakePeer{{name: "a", err: down}, {name: "b", err: down}, {name: "c"}}, -1, "c:Tom", false, 0, false},
+		//后续结点是自己时在本结点加载并缓存，不再尝试之后的结点
+		{"self next", Failover{NextPeers: 2}, 1, []*fakePeer{{name: "a", err: down}, {name: "c"}}, 1, "local:Tom", false, 1, true},
+		{"self next fail fast", Failover{NextPeers: 1, FailFast: true}, 1, []*fakePeer{{name: "a", err: down}}, 1, "local:Tom", false, 1, true},
+		{"skip cache", Failover{NextPeers: 1, SkipCache: true}, 1, []*fakePeer{{name: "a", err: down}, {name: "b", err: down}, {name: "c"}}, -1, "local:Tom", false, 1, false},
+		{"fail fast", Failover{NextPeers: 1, FailFast: true}, 1, []*fakePeer{{name: "a", err: down}, {name: "b", err: down}}, -1, "", true, 0, false},
+		//所有副本都失败之后尝试副本之后的结点
+		{"after replicas", Failover{NextPeers: 1}, 2, []*fakePeer{{name: "a", err: down}, {name: "b", err: down}, {name: "c"}, {name: "d"}}, -1, "c:Tom", false, 0, false},
+		{"replicas fail fast", Failover{FailFast: true}, 2, []*fakePeer{{name: "a", err: down}, {name: "b", err: down}, {name: "c"}}, -1, "", true, 0, false},
+	}
+
+	for _, c := range testCases {
+		//GetMulti 对远程请求失败的 key 使用与 Get 相同的策略
+		for _, multi := range []bool{false, true} {
+			name := c.name
+			g := newFakePeersGroup("failover", c.peers, c.self, WithFailover(c.failover), WithReplication(c.replicas, false))
+			if multi {
+				name += " (GetMulti)"
+				values, err := g.GetMulti([]string{"Tom"})
+				v, ok := values["Tom"]
+				if err != nil || ok == c.wantErr || (ok && v.String() != c.want) {
+					t.Errorf("%s: GetMulti returned %v, %v, want %q", name, values, err, c.want)
+				}
+			} else {
+				v, err := g.Get("Tom")
+				if c.wantErr {
+					if !errors.Is(err, down) {
+						t.Errorf("%s: expected the peer error, got %v", name, err)
+					}
+				} else if err != nil || v.String() != c.want {
+					t.Errorf("%s: Get returned %q, %v, want %q", name, v.String(), err, c.want)
+				}
+			}
+			if s := g.Stats(); s.LocalLoads != c.wantLocal {
+				t.Errorf("%s: expected %d local loads, got %d", name, c.wantLocal, s.LocalLoads)
+			}
+			if cached := g.CacheStats(MainCache).Items == 1; cached != c.cached {
+				t.Errorf("%s: cached=%v, want %v", name, cached, c.cached)
+			}
+			//不会尝试超过 NextPeers 个后续结点，也不会尝试自己之后的结点
+			for i, p := range c.peers {
+				tooFar := i >= c.replicas+c.failover.NextPeers || (c.self >= 0 && i >= c.self)
+				if tooFar && p.calls.Get() != 0 {
+					t.Errorf("%s: peer %s should not be tried", name, p.name)
+				}
+			}
+		}
+	}
+}
+
+func TestHedging(t *testing.T) {
+	slow, fast := 10*time.Second, time.Duration(0)
+	testCases := []struct {
+		name     string
+		replicas int
+		peers    []*fakePeer
+		want     string
+		sent     int64
+		won      int64
+		canceled int //被取消的请求所在的位置，-1 表示没有
+	}{
+		{"fast owner", 2, []*fakePeer{{name: "a", delay: fast}, {name: "b", delay: fast}}, "a:Tom", 0, 0, -1},
+		{"replica wins", 2, []*fakePeer{{name: "a", delay: slow}, {name: "b", delay: fast}}, "b:Tom", 1, 1, 0},
+		{"owner wins", 2, []*fakePeer{{name: "a", delay: 100 * time.Millisecond}, {name: "b", delay: slow}}, "a:Tom", 1, 0, 1},
+		{"local wins", 1, []*fakePeer{{name: "a", delay: slow}}, "local:Tom", 1, 1, 0},
+		//没有副本时后续结点上没有 key 的数据，对冲请求在本结点加载
+		{"no replica", 1, []*fakePeer{{name: "a", delay: slow}, {name: "b", delay: fast}}, "local:Tom", 1, 1, 0},
+	}
+
+	for _, c := range testCases {
+		g := newFakePeersGroup("hedging", c.peers, -1, WithHedging(20*time.Millisecond), WithReplication(c.replicas, false))
+
+		start := time.Now()
+		v, err := g.Get("Tom")
+		if err != nil || v.String() != c.want {
+			t.Errorf("%s: Get returned %q, %v, want %q", c.name, v.String(), err, c.want)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: Get took %v", c.name, elapsed)
+		}
+		if s := g.Stats(); s.HedgesSent != c.sent || s.HedgesWon != c.won {
+			t.Errorf("%s: expected %d hedges sent and %d won, got %+v", c.name, c.sent, c.won, s)
+		}
+		//不属于本结点的 key 不放入 mainCache
+		if g.CacheStats(MainCache).Items != 0 {
+			t.Errorf("%s: hedged value should not be cached", c.name)
+		}
+		//只会请求保存 key 的结点
+		for i, p := range c.peers {
+			if i >= c.replicas && i > 0 && p.calls.Get()+p.canceled.Get() != 0 {
+				t.Errorf("%s: peer %s holds no replica and should not be asked", c.name, p.name)
+			}
+		}
+		if c.canceled >= 0 {
+			p := c.peers[c.canceled]
+			deadline := time.Now().Add(time.Second)
+			for p.canceled.Get() == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if p.canceled.Get() != 1 {
+				t.Errorf("%s: the losing request to %s should be canceled", c.name, p.name)
+			}
+			//被取消的请求不算作远程结点的错误
+			time.Sleep(10 * time.Millisecond)
+			if n := g.Stats().PeerErrors; n != 0 {
+				t.Errorf("%s: canceled requests should not count as peer errors, got %d", c.name, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package gossip
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+//gossip 实现了 SWIM 协议，用来代替静态的结点列表和哨兵：
+//每一轮探测中，结点按照打乱后的顺序 ping 一个成员，超时后通过 k 个其他成员发送 ping-req 间接探测，
+//仍然失败则将其标记为 suspect；suspect 超过一段时间没有反驳(refute)就被标记为 dead，dead 再经过一段时间后从成员列表中删除。
+//成员的状态变化不单独发送，而是附带(piggyback)在 ping 和 ack 消息上传播。
+//每个成员都有 incarnation，只有自己可以增加它，用来反驳别人对自己的怀疑。
+
+var (
+	defaultPath             = "/_gossip/"
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 500 * time.Millisecond
+	defaultIndirectChecks   = 3
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultDeadTimeout      = 30 * time.Second
+	defaultRetransmitMult   = 3 //每条更新最多被附带 defaultRetransmitMult*log2(n) 次
+	defaultMaxPiggyback     = 8 //每条消息最多附带的更新数
+)
+
+// State 是成员的状态，数值越大优先级越高，incarnation 相同时高优先级的状态覆盖低优先级的状态
+type State int
+
+const (
+	Alive State = iota
+	Suspect
+	Dead
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Member 是某个成员的状态，Addr 为结点的地址，例如 http://localhost:8001
+type Member struct {
+	Addr        string `json:"addr"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+//overrides 判断更新 u 是否比 cur 新
+func overrides(u, cur Member) bool {
+	return u.Incarnation > cur.Incarnation || (u.Incarnation == cur.Incarnation && u.State > cur.State)
+}
+
+// Config 是 Memberlist 的配置，为零值的字段使用默认值
+type Config struct {
+	ProbeInterval    time.Duration //每隔多久探测一个成员
+	ProbeTimeout     time.Duration //ping 的超时时间
+	IndirectChecks   int           //直接 ping 失败后发送 ping-req 的成员数
+	SuspicionTimeout time.Duration //suspect 经过多久被判定为 dead
+	//DeadTimeout 是 dead 的成员被删除之前保留的时间，在此期间 dead 的状态继续传播，避免其他结点上旧的 alive 状态把它加回来。
+	//删除之后同一地址的结点可以重新加入，否则频繁更换地址的集群中 dead 的成员会越来越多
+	DeadTimeout time.Duration
+	//OnChange 在集群中的结点(alive 和 suspect 的成员以及自己)发生变化时调用，参数是排好序的地址。
+	//调用时不持有 Memberlist 的锁，多次调用是串行的，并且总是传入最新的结点列表
+	OnChange func(peers []string)
+}
+
+//message 是结点之间传递的消息，ping、ping-req、join 以及它们的响应都使用这一种格式
+type message struct {
+	From    string   `json:"from"`
+	Target  string   `json:"target,omitempty"` //ping-req 需要探测的成员
+	Ok      bool     `json:"ok,omitempty"`     //ping-req 的结果
+	Updates []Member `json:"updates,omitempty"`
+}
+
+//transport 负责向其他结点发送消息并返回响应，测试时可以替换为内存实现
+type transport interface {
+	send(addr, kind string, msg *message) (*message, error)
+}
+
+type member struct {
+	Member
+	since time.Time //进入当前状态的时间
+}
+
+// Memberlist 维护集群的成员列表
+type Memberlist struct {
+	self   string
+	config Config
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*member //不包括自己
+	queue       map[string]int     //等待附带传播的更新，值为已经附带的次数，更新的内容是成员当前的状态
+	probeList   []string
+	probeIndex  int
+	peers       []string //集群中当前的结点
+
+	notifyMu sync.Mutex //保证 OnChange 串行调用，在 mu 之前获取
+	notified []string   //上一次通知 OnChange 的结点，由 notifyMu 保护
+
+	transport transport
+	now       func() time.Time
+	rand      *rand.Rand
+}
+
+// New 创建自己的地址为 self 的 Memberlist，此时集群中只有自己
+func New(self string, config Config) *Memberlist {
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = defaultProbeInterval
+	}
+	if config.ProbeTimeout <= 0 {
+		config.ProbeTimeout = defaultProbeTimeout
+	}
+	if config.IndirectChecks <= 0 {
+		config.IndirectChecks = defaultIndirectChecks
+	}
+	if config.SuspicionTimeout <= 0 {
+		config.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if config.DeadTimeout <= 0 {
+		config.DeadTimeout = defaultDeadTimeout
+	}
+	m := &Memberlist{
+		self:    self,
+		config:  config,
+		members: make(map[string]*member),
+		queue:   make(map[string]int),
+		now:     time.Now,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	m.transport = newHTTPTransport(config.ProbeTimeout)
+	return m
+}
+
+func (m *Memberlist) Log(format string, v ...interface{}) {
+	log.Printf("[Gossip %s] %s", m.self, fmt.Sprintf(format, v...))
+}
+
+// Join 通过 seed 加入集群，seed 为空或者是自己时什么也不做，此时自己就是第一个结点
+func (m *Memberlist) Join(seed string) error {
+	if seed == "" || seed == m.self {
+		m.mu.Lock()
+		m.changed()
+		m.mu.Unlock()
+		m.notify()
+		return nil
+	}
+	m.mu.Lock()
+	req := &message{From: m.self, Updates: []Member{m.selfMember()}}
+	m.mu.Unlock()
+
+	res, err := m.transport.send(seed, "join", req)
+	if err != nil {
+		return err
+	}
+	m.merge(res.Updates)
+	return nil
+}
+
+// Run 每隔 ProbeInterval 探测一个成员，不会返回
+func (m *Memberlist) Run() {
+	ticker := time.NewTicker(m.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.probe()
+	}
+}
+
+// Members 返回包括自己在内的全部成员，按地址排序
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := []Member{m.selfMember()}
+	for _, mem := range m.members {
+		res = append(res, mem.Member)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Addr < res[j].Addr })
+	return res
+}
+
+//selfMember 返回自己的状态，调用时需持有 m.mu
+func (m *Memberlist) selfMember() Member {
+	return Member{Addr: m.self, State: Alive, Incarnation: m.incarnation}
+}
+
+//probe 进行一轮探测：ping 下一个成员，失败后间接探测，仍然失败则怀疑它，最后清理超时的 suspect 和 dead
+func (m *Memberlist) probe() {
+	if target := m.nextTarget(); target != "" {
+		if err := m.ping(target); err != nil {
+			m.Log("ping %s failed: %v", target, err)
+			if !m.indirectPing(target) {
+				m.suspect(target)
+			}
+		}
+	}
+	m.reapSuspects()
+}
+
+//nextTarget 按照打乱后的顺序轮流返回未被判定为 dead 的成员，没有成员时返回空字符串
+func (m *Memberlist) nextTarget() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		for m.probeIndex < len(m.probeList) {
+			addr := m.probeList[m.probeIndex]
+			m.probeIndex++
+			if mem, ok := m.members[addr]; ok && mem.State != Dead {
+				return addr
+			}
+		}
+		//一轮结束后重新打乱
+		m.probeList = m.probeList[:0]
+		for addr := range m.members {
+			m.probeList = append(m.probeList, addr)
+		}
+		sort.Strings(m.probeList)
+		m.rand.Shuffle(len(m.probeList), func(i, j int) {
+			m.probeList[i], m.probeList[j] = m.probeList[j], m.probeList[i]
+		})
+		m.probeIndex = 0
+	}
+	return ""
+}
+
+//ping 直接探测 target，并交换附带的更新
+func (m *Memberlist) ping(target string) error {
+	res, err := m.transport.send(target, "ping", m.newMessage(""))
+	if err != nil {
+		return err
+	}
+	m.merge(res.Updates)
+	return nil
+}
+
+//indirectPing 请求最多 IndirectChecks 个其他成员探测 target，只要有一个成功就返回 true
+func (m *Memberlist) indirectPing(target string) bool {
+	m.mu.Lock()
+	var helpers []string
+	for addr, mem := range m.members {
+		if addr != target && mem.State == Alive {
+			helpers = append(helpers, addr)
+		}
+	}
+	sort.Strings(helpers)
+	m.rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > m.config.IndirectChecks {
+		helpers = helpers[:m.config.IndirectChecks]
+	}
+	m.mu.Unlock()
+
+	ok := false
+	for _, helper := range helpers {
+		res, err := m.transport.send(helper, "ping-req", m.newMessage(target))
+		if err != nil {
+			continue
+		}
+		m.merge(res.Updates)
+		ok = ok || res.Ok
+	}
+	return ok
+}
+
+//suspect 把 target 标记为 suspect，并传播这一更新
+func (m *Memberlist) suspect(target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mem, ok := m.members[target]
+	if !ok || mem.State != Alive {
+		return
+	}
+	m.Log("suspect %s", target)
+	m.setState(mem, Suspect)
+}
+
+//reapSuspects 把超过 SuspicionTimeout 仍未反驳的 suspect 标记为 dead，并删除超过 DeadTimeout 的 dead 成员
+func (m *Memberlist) reapSuspects() {
+	m.mu.Lock()
+	for addr, mem := range m.members {
+		switch {
+		case mem.State == Suspect && m.now().Sub(mem.since) >= m.config.SuspicionTimeout:
+			m.Log("%s is dead", addr)
+			m.setState(mem, Dead)
+		case mem.State == Dead && m.now().Sub(mem.since) >= m.config.DeadTimeout:
+			m.Log("forget dead member %s", addr)
+			delete(m.members, addr)
+			delete(m.queue, addr)
+		}
+	}
+	m.changed()
+	m.mu.Unlock()
+	m.notify()
+}
+
+//setState 修改成员的状态并加入传播队列，调用时需持有 m.mu
+func (m *Memberlist) setState(mem *member, state State) {
+	mem.State = state
+	mem.since = m.now()
+	m.queue[mem.Addr] = 0
+}
+
+//newMessage 创建一条附带了待传播更新的消息
+func (m *Memberlist) newMessage(target string) *message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &message{From: m.self, Target: target, Updates: m.piggyback()}
+}
+
+//piggyback 取出最多 defaultMaxPiggyback 条附带次数最少的更新，调用时需持有 m.mu
+func (m *Memberlist) piggyback() []Member {
+	addrs := make([]string, 0, len(m.queue))
+	for addr := range m.queue {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if m.queue[addrs[i]] != m.queue[addrs[j]] {
+			return m.queue[addrs[i]] < m.queue[addrs[j]]
+		}
+		return addrs[i] < addrs[j]
+	})
+	if len(addrs) > defaultMaxPiggyback {
+		addrs = addrs[:defaultMaxPiggyback]
+	}
+
+	limit := m.retransmitLimit()
+	var updates []Member
+	for _, addr := range addrs {
+		if addr == m.self {
+			updates = append(updates, m.selfMember())
+		} else if mem, ok := m.members[addr]; ok {
+			updates = append(updates, mem.Member)
+		}
+		m.queue[addr]++
+		if m.queue[addr] >= limit {
+			delete(m.queue, addr)
+		}
+	}
+	return updates
+}
+
+//retransmitLimit 返回每条更新最多附带的次数，随集群规模对数增长，调用时需持有 m.mu
+func (m *Memberlist) retransmitLimit() int {
+	n := 1
+	for size := len(m.members) + 1; size > 1; size >>= 1 {
+		n++
+	}
+	return defaultRetransmitMult * n
+}
+
+//merge 合并收到的更新，集群中的结点发生变化时调用 OnChange
+func (m *Memberlist) merge(updates []Member) {
+	m.mu.Lock()
+	for _, u := range updates {
+		m.apply(u)
+	}
+	m.changed()
+	m.mu.Unlock()
+	m.notify()
+}
+
+//apply 合并一条更新，调用时需持有 m.mu
+func (m *Memberlist) apply(u Member) {
+	if u.Addr == "" {
+		return
+	}
+	if u.Addr == m.self {
+		//别人怀疑自己或者认为自己已经下线，增加 incarnation 反驳
+		if u.State != Alive && u.Incarnation >= m.incarnation {
+			m.incarnation = u.Incarnation + 1
+			m.queue[m.self] = 0
+			m.Log("refute %s at incarnation %d", u.State, m.incarnation)
+		}
+		return
+	}
+
+	mem, ok := m.members[u.Addr]
+	if !ok {
+		//不认识的成员已经下线，没有必要记录
+		if u.State == Dead {
+			return
+		}
+		m.members[u.Addr] = &member{Member: u, since: m.now()}
+		m.queue[u.Addr] = 0
+		return
+	}
+	if !overrides(u, mem.Member) {
+		return
+	}
+	mem.Incarnation = u.Incarnation
+	m.setState(mem, u.State)
+}
+
+//changed 重新计算集群中的结点，调用时需持有 m.mu。释放 m.mu 之后需要调用 notify 通知 OnChange
+func (m *Memberlist) changed() {
+	peers := []string{m.self}
+	for addr, mem := range m.members {
+		if mem.State != Dead {
+			peers = append(peers, addr)
+		}
+	}
+	sort.Strings(peers)
+	if equal(peers, m.peers) {
+		return
+	}
+	m.peers = peers
+	m.Log("peers changed: %v", peers)
+}
+
+//notify 在结点与上一次通知时不同时调用 OnChange，调用时不能持有 m.mu。
+//notifyMu 使通知串行进行，并且每次读取最新的结点，并发的变化不会以相反的顺序通知
+func (m *Memberlist) notify() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	m.mu.Lock()
+	peers := m.peers
+	m.mu.Unlock()
+	if peers == nil || equal(peers, m.notified) {
+		return
+	}
+	m.notified = peers
+	if m.config.OnChange != nil {
+		m.config.OnChange(peers)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//handle 处理其他结点发来的消息，返回响应
+func (m *Memberlist) handle(kind string, req *message) (*message, error) {
+	switch kind {
+	case "ping":
+		//发送者可能是刚加入的结点，还没有传播到这里
+		m.merge(append(req.Updates, Member{Addr: req.From}))
+		return m.newMessage(""), nil
+	case "ping-req":
+		m.merge(req.Updates)
+		res := m.newMessage("")
+		res.Ok = m.ping(req.Target) == nil
+		return res, nil
+	case "join":
+		m.mu.Lock()
+		if mem, ok := m.members[req.From]; ok && mem.State != Alive {
+			//结点重启后 incarnation 从 0 开始，需要比之前的记录大才能覆盖 suspect 和 dead
+			mem.Incarnation++
+			m.setState(mem, Alive)
+		}
+		for _, u := range req.Updates {
+			m.apply(u)
+		}
+		m.apply(Member{Addr: req.From})
+		m.changed()
+		res := &message{From: m.self, Updates: []Member{m.selfMember()}}
+		for _, mem := range m.members {
+			res.Updates = append(res.Updates, mem.Member)
+		}
+		m.mu.Unlock()
+		m.notify()
+		return res, nil
+	}
+	return nil, fmt.Errorf("unknown message: %s", kind)
+}
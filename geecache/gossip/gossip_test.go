@@ -0,0 +1,256 @@
+package gossip
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//memNetwork 在内存中同步地传递消息，可以让结点下线或者切断两个结点之间的连接
+type memNetwork struct {
+	mu    sync.Mutex
+	nodes map[string]*Memberlist
+	down  map[string]bool
+	cut   map[[2]string]bool
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{
+		nodes: make(map[string]*Memberlist),
+		down:  make(map[string]bool),
+		cut:   make(map[[2]string]bool),
+	}
+}
+
+func (n *memNetwork) disconnect(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut[[2]string{a, b}] = true
+	n.cut[[2]string{b, a}] = true
+}
+
+type memTransport struct {
+	net  *memNetwork
+	from string
+}
+
+func (t *memTransport) send(addr, kind string, msg *message) (*message, error) {
+	t.net.mu.Lock()
+	node, ok := t.net.nodes[addr]
+	unreachable := !ok || t.net.down[addr] || t.net.cut[[2]string{t.from, addr}]
+	t.net.mu.Unlock()
+	if unreachable {
+		return nil, fmt.Errorf("%s unreachable", addr)
+	}
+	return node.handle(kind, msg)
+}
+
+//testCluster 是一组使用同一个假时钟的结点
+type testCluster struct {
+	net   *memNetwork
+	nodes []*Memberlist
+	clock time.Time
+	peers map[string][]string //每个结点最后一次 OnChange 收到的结点
+	mu    sync.Mutex
+}
+
+func newTestCluster(t *testing.T, n int) *testCluster {
+	c := &testCluster{net: newMemNetwork(), clock: time.Unix(0, 0), peers: make(map[string][]string)}
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("http://node-%d", i)
+		m := New(addr, Config{OnChange: func(peers []string) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.peers[addr] = peers
+		}})
+		m.transport = &memTransport{net: c.net, from: addr}
+		m.now = func() time.Time { return c.clock }
+		m.rand = rand.New(rand.NewSource(int64(i)))
+		c.net.nodes[addr] = m
+		c.nodes = append(c.nodes, m)
+	}
+	for _, m := range c.nodes {
+		if err := m.Join(c.nodes[0].self); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+//rounds 让所有在线的结点进行 n 轮探测
+func (c *testCluster) rounds(n int) {
+	for i := 0; i < n; i++ {
+		for _, m := range c.nodes {
+			if !c.net.down[m.self] {
+				m.probe()
+			}
+		}
+	}
+}
+
+func (c *testCluster) peersOf(m *Memberlist) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peers[m.self]
+}
+
+func (c *testCluster) addrs(nodes ...*Memberlist) []string {
+	var res []string
+	for _, m := range nodes {
+		res = append(res, m.self)
+	}
+	return res
+}
+
+func stateOf(m *Memberlist, addr string) Member {
+	for _, mem := range m.Members() {
+		if mem.Addr == addr {
+			return mem
+		}
+	}
+	return Member{}
+}
+
+func TestJoin(t *testing.T) {
+	c := newTestCluster(t, 4)
+	c.rounds(5)
+
+	want := c.addrs(c.nodes...)
+	for _, m := range c.nodes {
+		if got := c.peersOf(m); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s should see %v, got %v", m.self, want, got)
+		}
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	c := newTestCluster(t, 4)
+	c.rounds(5)
+
+	dead := c.nodes[3]
+	c.net.down[dead.self] = true
+	c.rounds(5)
+	for _, m := range c.nodes[:3] {
+		if s := stateOf(m, dead.self).State; s != Suspect {
+			t.Fatalf("%s should suspect %s, got %v", m.self, dead.self, s)
+		}
+		//suspect 依然留在集群中
+		if got := c.peersOf(m); len(got) != 4 {
+			t.Fatalf("%s should still have 4 peers, got %v", m.self, got)
+		}
+	}
+
+	c.clock = c.clock.Add(defaultSuspicionTimeout)
+	c.rounds(5)
+	want := c.addrs(c.nodes[:3]...)
+	for _, m := range c.nodes[:3] {
+		if s := stateOf(m, dead.self).State; s != Dead {
+			t.Fatalf("%s should mark %s dead, got %v", m.self, dead.self, s)
+		}
+		if got := c.peersOf(m); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s should see %v, got %v", m.self, want, got)
+		}
+	}
+
+	//dead 的成员经过 DeadTimeout 之后被删除
+	c.clock = c.clock.Add(defaultDeadTimeout)
+	c.rounds(5)
+	for _, m := range c.nodes[:3] {
+		if mem := stateOf(m, dead.self); mem.Addr != "" || len(m.Members()) != 3 {
+			t.Fatalf("%s should forget %s, got %v", m.self, dead.self, m.Members())
+		}
+	}
+
+	//结点重启后重新加入集群
+	c.net.down[dead.self] = false
+	restarted := New(dead.self, Config{})
+	restarted.transport, restarted.now = dead.transport, dead.now
+	c.net.nodes[dead.self] = restarted
+	c.nodes[3] = restarted
+	if err := restarted.Join(c.nodes[0].self); err != nil {
+		t.Fatal(err)
+	}
+	c.rounds(5)
+	for _, m := range c.nodes[:3] {
+		if s := stateOf(m, dead.self).State; s != Alive {
+			t.Fatalf("%s should see %s alive again, got %v", m.self, dead.self, s)
+		}
+	}
+}
+
+func TestIndirectPing(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.rounds(3)
+
+	//node-0 无法直接访问 node-1，但可以通过 node-2 间接探测
+	c.net.disconnect(c.nodes[0].self, c.nodes[1].self)
+	c.rounds(5)
+	for _, m := range c.nodes {
+		for _, mem := range m.Members() {
+			if mem.State != Alive {
+				t.Fatalf("%s should see %s alive, got %v", m.self, mem.Addr, mem.State)
+			}
+		}
+	}
+}
+
+func TestRefute(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.rounds(3)
+
+	//node-0 错误地怀疑 node-1，node-1 收到后增加 incarnation 反驳
+	target := c.nodes[1].self
+	c.nodes[0].mu.Lock()
+	c.nodes[0].setState(c.nodes[0].members[target], Suspect)
+	c.nodes[0].mu.Unlock()
+
+	c.rounds(5)
+	for _, m := range c.nodes {
+		mem := stateOf(m, target)
+		if mem.State != Alive || mem.Incarnation != 1 {
+			t.Fatalf("%s should see %s alive at incarnation 1, got %+v", m.self, target, mem)
+		}
+	}
+}
+
+func TestOnChangeUnlocked(t *testing.T) {
+	var m *Memberlist
+	done := make(chan []Member, 1)
+	//OnChange 调用时不持有锁，可以在其中调用 Memberlist 的方法
+	m = New("http://node-0", Config{OnChange: func(peers []string) {
+		done <- m.Members()
+	}})
+	go m.Join("")
+	select {
+	case members := <-done:
+		if len(members) != 1 {
+			t.Fatalf("expected only self, got %v", members)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnChange should not be called while holding the lock")
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	var nodes []*Memberlist
+	for i := 0; i < 2; i++ {
+		m := New("", Config{})
+		server := httptest.NewServer(m)
+		t.Cleanup(server.Close)
+		m.self = server.URL
+		nodes = append(nodes, m)
+	}
+	if err := nodes[1].Join(nodes[0].self); err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].probe()
+	for _, m := range nodes {
+		if len(m.Members()) != 2 {
+			t.Fatalf("%s should know 2 members, got %v", m.self, m.Members())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServeHTTP 处理其他结点发来的消息，路径为 /_gossip/<kind>，请求体和响应体都是 JSON
+func (m *Memberlist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, defaultPath) || r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	req := &message{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := m.handle(r.URL.Path[len(defaultPath):], req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+//httpTransport 是默认的 transport，通过 HTTP 传递 JSON 消息
+type httpTransport struct {
+	client  *http.Client
+	timeout time.Duration
+}
+
+func newHTTPTransport(timeout time.Duration) *httpTransport {
+	return &httpTransport{client: &http.Client{}, timeout: timeout}
+}
+
+func (t *httpTransport) send(addr, kind string, msg *message) (*message, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	//ping-req 需要等待对方再 ping 一次目标结点，所以超时时间加倍
+	timeout := t.timeout
+	if kind == "ping-req" {
+		timeout *= 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+defaultPath+kind, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("server returned: %v %s", res.Status, body)
+	}
+	reply := &message{}
+	if err := json.NewDecoder(res.Body).Decode(reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,243 @@
+package geecache
+
+import (
+	"cache/geecache/consistenthash"
+	"cache/geecache/pb"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"sync"
+	"time"
+)
+
+// GRPCPool 与 HTTPPool 作用相同，但结点间通过 proto 中声明的 GroupCache gRPC 服务通信
+// GRPCPool 既是 PeerPicker，也是 pb.GroupCacheServer 的实现
+type GRPCPool struct {
+	pb.UnimplementedGroupCacheServer
+	self        string //自己的地址,例如 localhost:8001，注意没有 http:// 前缀
+	mu          sync.Mutex
+	peers       *consistenthash.Map    //用来根据具体的 key 选择节点
+	grpcGetters map[string]*grpcGetter //映射远程节点与对应的 grpcGetter，每个 grpcGetter 持有一条长连接
+	getGroup    func(name string) *Group //根据名称查找 Group，为 nil 时使用全局的 GetGroup
+	// Timeout 是每个请求的超时时间，默认为 3 秒，小于 0 时不设置超时，需要在 Set 之前修改
+	Timeout time.Duration
+}
+
+func NewGRPCPool(self string) *GRPCPool {
+	return &GRPCPool{
+		self:    self,
+		Timeout: defaultTimeout,
+	}
+}
+
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[gRPC Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+//group 根据名称查找本结点上的 Group
+func (p *GRPCPool) group(name string) *Group {
+	if p.getGroup != nil {
+		return p.getGroup(name)
+	}
+	return GetGroup(name)
+}
+
+// Set 更新结点列表，已有结点的连接会被复用，不再存在的结点的连接会被关闭
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if getter, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = getter
+			continue
+		}
+		if peer == p.self {
+			continue
+		}
+		getter, err := newGRPCGetter(peer, p.Timeout)
+		if err != nil {
+			p.Log("dial peer %s failed: %v", peer, err)
+			continue
+		}
+		getters[peer] = getter
+	}
+	for peer, getter := range p.grpcGetters {
+		if _, ok := getters[peer]; !ok {
+			getter.close()
+		}
+	}
+	p.grpcGetters = getters
+}
+
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		if getter, ok := p.grpcGetters[peer]; ok {
+			p.Log("Pick peer %s", peer)
+			return getter, true
+		}
+	}
+	return nil, false
+}
+
+// Close 关闭所有到远程结点的连接
+func (p *GRPCPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, getter := range p.grpcGetters {
+		getter.close()
+	}
+	p.grpcGetters = nil
+}
+
+// Get 实现 pb.GroupCacheServer，处理其他结点发来的查询请求
+func (p *GRPCPool) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group := p.group(in.GetGroup())
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", in.GetGroup())
+	}
+
+	group.stats.ServerRequests.Add(1)
+	view, err := group.GetContext(withFromPeer(ctx), in.GetKey())
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &pb.Response{Value: view.ByteSlice()}, nil
+}
+
+// Remove 实现 pb.GroupCacheServer，只删除本结点上的缓存
+func (p *GRPCPool) Remove(ctx context.Context, in *pb.Request) (*pb.RemoveResponse, error) {
+	group := p.group(in.GetGroup())
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", in.GetGroup())
+	}
+	return &pb.RemoveResponse{Removed: group.removeLocally(in.GetKey())}, nil
+}
+
+// GetMulti 实现 pb.GroupCacheServer，一次返回多个 key 的值
+func (p *GRPCPool) GetMulti(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	group := p.group(in.GetGroup())
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", in.GetGroup())
+	}
+
+	group.stats.ServerRequests.Add(1)
+	views, err := group.GetMultiContext(withFromPeer(ctx), in.GetKeys())
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	res := &pb.BatchResponse{Values: make(map[string][]byte, len(views))}
+	for k, v := range views {
+		res.Values[k] = v.ByteSlice()
+	}
+	return res, nil
+}
+
+//grpcGetter 是 gRPC 客户端，实现PeerGetter接口
+type grpcGetter struct {
+	addr    string
+	conn    *grpc.ClientConn
+	client  pb.GroupCacheClient
+	timeout time.Duration //每个请求的超时时间，小于等于 0 时不设置
+}
+
+//newGRPCGetter 建立到 addr 的连接，grpc.Dial 不会阻塞，连接断开后会自动重连
+func newGRPCGetter(addr string, timeout time.Duration) (*grpcGetter, error) {
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &grpcGetter{
+		addr:    addr,
+		conn:    conn,
+		client:  pb.NewGroupCacheClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+//withTimeout 在 g.timeout 大于 0 时为 ctx 加上超时，ctx 的截止时间更早时以 ctx 为准
+func (g *grpcGetter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout > 0 {
+		return context.WithTimeout(ctx, g.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (g *grpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+//GetContext 与 Get 相同，请求最多持续 g.timeout，gRPC 会自动把 ctx 的截止时间传给远程结点
+func (g *grpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	res, err := g.client.Get(ctx, in)
+	if err != nil {
+		return grpcError(err)
+	}
+	out.Value = res.GetValue()
+	return nil
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	res, err := g.client.GetMulti(ctx, in)
+	if err != nil {
+		return grpcError(err)
+	}
+	out.Values = res.GetValues()
+	return nil
+}
+
+func (g *grpcGetter) Remove(in *pb.Request, out *pb.RemoveResponse) error {
+	ctx, cancel := g.withTimeout(context.Background())
+	defer cancel()
+	res, err := g.client.Remove(ctx, in)
+	if err != nil {
+		return grpcError(err)
+	}
+	out.Removed = res.GetRemoved()
+	return nil
+}
+
+//grpcError 把 gRPC 的 Canceled 和 DeadlineExceeded 转换为 context 中对应的错误，
+//这样输掉的对冲请求等被取消的请求与 HTTP 一样不会计入远程结点的错误
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (g *grpcGetter) close() {
+	g.conn.Close()
+}
+
+var _ PeerGetter = (*grpcGetter)(nil)
+
+var _ ContextPeerGetter = (*grpcGetter)(nil)
+
+var _ BatchPeerGetter = (*grpcGetter)(nil)
+
+var _ PeerRemover = (*grpcGetter)(nil)
+
+var _ PeerPicker = (*GRPCPool)(nil)
+
+var _ pb.GroupCacheServer = (*GRPCPool)(nil)
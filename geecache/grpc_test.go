@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"cache/geecache/pb"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+//startTestGRPCCluster 在进程内启动 n 个使用 gRPC 通信的结点
+func startTestGRPCCluster(t *testing.T, n int, name string, getter Getter, opts ...GroupOption) ([]*GRPCPool, []*Group) {
+	pools := make([]*GRPCPool, n)
+	groups := make([]*Group, n)
+	addrs := make([]string, n)
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		group := newGroup(name, 2 << 10, getter, opts...)
+		pool := NewGRPCPool(lis.Addr().String())
+		pool.getGroup = func(groupName string) *Group {
+			if groupName == group.name {
+				return group
+			}
+			return nil
+		}
+		server := grpc.NewServer()
+		pb.RegisterGroupCacheServer(server, pool)
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+		t.Cleanup(pool.Close)
+
+		pools[i], groups[i], addrs[i] = pool, group, pool.self
+	}
+	for i, pool := range pools {
+		pool.Set(addrs...)
+		groups[i].RegisterPeers(pool)
+	}
+	return pools, groups
+}
+
+func TestGRPCPool(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	pools, groups := startTestGRPCCluster(t, 3, "grpc", GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			loads[key]++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	for k, v := range db {
+		owner := pools[0].peers.Get(k)
+		for i, group := range groups {
+			if view, err := group.Get(k); err != nil || view.String() != v {
+				t.Fatalf("node %s get %s failed: %q %v", pools[i].self, k, view, err)
+			}
+		}
+		if loads[k] != 1 {
+			t.Fatalf("%s should be loaded once by its owner, got %d", k, loads[k])
+		}
+		for i, pool := range pools {
+			if _, ok := groups[i].mainCache.get(k); ok != (pool.self == owner) {
+				t.Fatalf("%s cached on %s: %v, owner is %s", k, pool.self, ok, owner)
+			}
+		}
+		for _, group := range groups {
+			if err := group.Remove(k); err != nil {
+				t.Fatalf("remove %s failed: %v", k, err)
+			}
+		}
+		for i := range pools {
+			if _, ok := groups[i].mainCache.get(k); ok {
+				t.Fatalf("%s should be removed from %s", k, pools[i].self)
+			}
+		}
+	}
+
+	if _, err := groups[0].Get("unknown"); err == nil {
+		t.Fatal("the value of unknown should be empty")
+	}
+}
+
+func TestGRPCTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	pools, _ := startTestGRPCCluster(t, 1, "grpc-timeout", GetterFunc(
+		func(key string) ([]byte, error) {
+			<-block
+			return []byte(key), nil
+		}))
+
+	getter, err := newGRPCGetter(pools[0].self, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer getter.close()
+	start := time.Now()
+	err = getter.Get(&pb.Request{Group: "grpc-timeout", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request should time out after 50ms, took %v", elapsed)
+	}
+}
+
+func TestGRPCHedging(t *testing.T) {
+	pools, groups := startTestGRPCCluster(t, 2, "grpc-hedging", ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			//所属结点很慢，对冲请求在本结点加载
+			if fromPeer(ctx) {
+				select {
+				case <-time.After(10 * time.Second):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			return []byte(key), nil
+		}), WithHedging(20*time.Millisecond))
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if pools[0].peers.Get(fmt.Sprintf("key%d", i)) == pools[1].self {
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	if v, err := groups[0].Get(key); err != nil || v.String() != key {
+		t.Fatalf("Get returned %q, %v", v.String(), err)
+	}
+	//输掉的请求被取消，gRPC 返回的 Canceled 不算作远程结点的错误
+	time.Sleep(50 * time.Millisecond)
+	if s := groups[0].Stats(); s.HedgesWon != 1 || s.PeerErrors != 0 {
+		t.Fatalf("the canceled request should not count as a peer error, got %+v", s)
+	}
+}
@@ -1,15 +1,22 @@
 package geecache
 
 import (
+	"bytes"
 	"cache/geecache/consistenthash"
+	"cache/geecache/placement"
 	"cache/geecache/pb"
+	"context"
+	"errors"
 	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/proto"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,26 +25,128 @@ import (
 const defaultBasePath = "/_geecache/"
 const defaultReplicas = 3
 
+//defaultTimeout 是结点间每个请求的默认超时时间，ctx 的截止时间更早时以 ctx 为准
+const defaultTimeout = 3 * time.Second
+
+//defaultMaxIdleConnsPerHost 是默认与每个远程结点保持的空闲连接数，
+//http.DefaultTransport 只有 2 个，并发请求较多时会不断新建连接
+const defaultMaxIdleConnsPerHost = 64
+
+//timeoutHeader 携带请求方剩余的超时时间，远程结点据此为本次查询设置截止时间
+const timeoutHeader = "X-Geecache-Timeout"
+
 // HTTPPool 作为承载结点间HTTP通信的核心数据结构
 type HTTPPool struct {
 	self        string			//自己的地址,包括ip和端口
 	basePath    string		//basePath，作为节点间通讯地址的前缀
 	mu          sync.Mutex
-	peers       *consistenthash.Map    //用来根据具体的 key 选择节点
+	peers       placement.Placement    //用来根据具体的 key 选择节点
+	weights     map[string]int //SetWeighted 配置的每个结点的权重，结点被删除之后重新加入时使用，由 mu 保护
+	newPlacement func() placement.Placement //创建 peers，为 nil 时使用一致性哈希环
 	httpGetters map[string]*httpGetter //映射远程节点与对应的 httpGetter。每一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关。
 	//failedPeers map[string]*time.Time  //记录失去连接的结点以及时间
+	getGroup    func(name string) *Group //根据名称查找 Group，为 nil 时使用全局的 GetGroup
+	peerStats   map[string]*peerStats //每个远程结点的请求数和错误数，由 mu 保护
+	epoch       uint64 //哈希环每变化一次加 1，由 mu 保护
+	sentinelEpoch uint64 //收到的哨兵消息中最大的 epoch，由 mu 保护
+	peerEpochs  map[string]uint64 //每个结点最后一次生效的哨兵消息的 epoch，由 mu 保护
+	loadEpsilon float64 //大于 0 时使用有界负载的一致性哈希选择结点，由 mu 保护
+	localInflight AtomicInt //本结点为自己的调用方在本地进行中的加载数，与远程结点的 inflight 含义相同，作为自己的负载
+	breakerConfig BreakerConfig //每个远程结点的熔断器的配置，由 mu 保护
+	opts        HTTPPoolOptions
+	client      *http.Client //所有 httpGetter 共享的客户端，复用与远程结点之间的连接
+}
+
+// HTTPPoolOptions 是 HTTPPool 的可选配置，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// BasePath 是结点间通信的路径前缀，默认为 "/_geecache/"
+	BasePath string
+
+	// Replicas 是一致性哈希环上每个结点的虚拟结点数，默认为 3
+	Replicas int
+
+	// HashFn 是一致性哈希环使用的哈希函数，默认为 crc32.ChecksumIEEE
+	HashFn consistenthash.Hash
+
+	// Transport 用于向远程结点发送请求，默认创建一个与每个远程结点保持 MaxIdleConnsPerHost 个空闲连接的 http.Transport
+	Transport http.RoundTripper
+
+	// MaxIdleConnsPerHost 只在 Transport 为 nil 时使用，默认为 64
+	MaxIdleConnsPerHost int
+
+	// Timeout 是每个请求的超时时间，默认为 3 秒，小于 0 时不设置超时
+	Timeout time.Duration
+
+	// AdminToken 是访问 /_admin/peers 以及向结点推送副本(PUT basePath/<group>/<key>)需要的令牌，
+	// 请求需要带上 "Authorization: Bearer <AdminToken>"。为空时关闭这两个接口，避免任何能访问缓存端口的人修改哈希环或者写入缓存，
+	// 开启副本推送时所有结点需要配置相同的 AdminToken
+	AdminToken string
 }
 
 type failMsg struct {
 	DetectedTime time.Time 	`json:"detected_time"`
 	SentinelName string 	`json:"sentinel_name"`
 	PeerName string			`json:"peer_name"`
+	Event string			`json:"event"`	//down 表示结点下线，up 表示结点重新上线，为空时视为 down
+	Epoch uint64			`json:"epoch"`	//哨兵消息的 epoch，单调递增，为 0 时表示旧版本的哨兵，参见 acceptEpoch
 }
 
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 与 NewHTTPPool 相同，但可以通过 o 配置路径前缀、哈希环以及结点间请求的传输层和超时时间
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
 		self: self,
-		basePath: defaultBasePath,
+		breakerConfig: DefaultBreakerConfig,
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultTimeout
+	}
+	if p.opts.Transport == nil {
+		p.opts.Transport = newTransport(p.opts.MaxIdleConnsPerHost)
+	}
+	p.basePath = p.opts.BasePath
+	p.client = &http.Client{Transport: p.opts.Transport}
+	return p
+}
+
+//newTransport 创建结点间使用的 http.Transport，与 http.DefaultTransport 相同，但与每个远程结点保持更多的空闲连接
+func newTransport(maxIdleConnsPerHost int) *http.Transport {
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout: 90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+//newGetter 创建访问 peer 的 httpGetter，调用时需持有 p.mu
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL: peer + p.basePath,
+		stats: p.statsOf(peer),
+		client: p.client,
+		timeout: p.opts.Timeout,
+		token: p.opts.AdminToken,
 	}
 }
 
@@ -45,26 +154,142 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
+//group 根据名称查找本结点上的 Group
+func (p *HTTPPool) group(name string) *Group {
+	if p.getGroup != nil {
+		return p.getGroup(name)
+	}
+	return GetGroup(name)
+}
+
+//ListenSentinel 处理哨兵发来的消息，结点下线时将其从哈希环中删除，重新上线时再加回哈希环，
+//epoch 不大于该结点上一条消息的 epoch 时说明消息被延迟或者乱序了，直接忽略并返回 409
 func (p *HTTPPool) ListenSentinel(w http.ResponseWriter, r *http.Request) {
 	body, _ := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
-	//if p.failedPeers == nil {
-	//	p.failedPeers = make(map[string]*time.Time)
-	//}
-
 	msg := failMsg{}
-	json.Unmarshal(body, &msg)
-	//if _, ok := p.failedPeers[msg.PeerName]; !ok {
-		delete(p.httpGetters, msg.PeerName)
-		p.peers.Remove(msg.PeerName)
-		//p.failedPeers[msg.PeerName] = &msg.DetectedTime
-		p.Log("%s %s", "delete failed peer", msg.PeerName)
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Write([]byte(fmt.Sprintf("%s delete failed peer %s succeed", p.self, msg.PeerName)))
-	//} else {
-	//	w.Write([]byte(fmt.Sprintf("%s delete failed peer %s succeed", p.self, msg.PeerName)))
-	//}
+	if err := json.Unmarshal(body, &msg); err != nil || msg.PeerName == "" {
+		http.Error(w, "bad sentinel message", http.StatusBadRequest)
+		return
+	}
+
+	//检查 epoch 和修改哈希环需要在同一次加锁中完成，否则两条消息可能以相反的顺序生效
+	p.mu.Lock()
+	if !p.acceptEpoch(msg.PeerName, msg.Epoch) {
+		last := p.peerEpochs[msg.PeerName]
+		p.mu.Unlock()
+		p.Log("ignore stale %s message for %s, epoch %d <= %d", msg.Event, msg.PeerName, msg.Epoch, last)
+		http.Error(w, fmt.Sprintf("stale epoch %d, current %d", msg.Epoch, last), http.StatusConflict)
+		return
+	}
+	if msg.Event == "up" {
+		p.addPeers(msg.PeerName)
+	} else {
+		p.removePeers(msg.PeerName)
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if msg.Event == "up" {
+		p.Log("%s %s", "add recovered peer", msg.PeerName)
+		w.Write([]byte(fmt.Sprintf("%s add recovered peer %s succeed", p.self, msg.PeerName)))
+		return
+	}
+	p.Log("%s %s", "delete failed peer", msg.PeerName)
+	w.Write([]byte(fmt.Sprintf("%s delete failed peer %s succeed", p.self, msg.PeerName)))
+}
+
+//acceptEpoch 判断关于 peer 的哨兵消息是否比上一条新，是则记录其 epoch，调用时需持有 p.mu。
+//epoch 为 0 的消息来自不带 epoch 的旧版哨兵，只有在从未收到过关于 peer 的带 epoch 的消息时才接受，
+//否则一条延迟到达的旧消息就能覆盖较新的状态
+func (p *HTTPPool) acceptEpoch(peer string, epoch uint64) bool {
+	if epoch == 0 {
+		return p.peerEpochs[peer] == 0
+	}
+	if epoch <= p.peerEpochs[peer] {
+		return false
+	}
+	if p.peerEpochs == nil {
+		p.peerEpochs = make(map[string]uint64)
+	}
+	p.peerEpochs[peer] = epoch
+	if epoch > p.sentinelEpoch {
+		p.sentinelEpoch = epoch
+	}
+	return true
+}
+
+// AddPeer 把 peers 加入哈希环，已经在环上的结点会被忽略，哈希环发生变化时 epoch 加 1
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addPeers(peers...)
+}
+
+//addPeers 与 AddPeer 相同，调用时需持有 p.mu
+func (p *HTTPPool) addPeers(peers ...string) {
+	if p.peers == nil {
+		p.peers = p.placement()
+		p.httpGetters = make(map[string]*httpGetter)
+	}
+	wp, weighted := p.peers.(placement.WeightedPlacement)
+	changed := false
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		//之前配置过权重的结点(例如哨兵通知恢复的结点)使用原来的权重
+		if weighted && p.weights[peer] > 0 {
+			wp.AddWeighted(peer, p.weights[peer])
+		} else if weighted {
+			wp.Add(peer)
+		}
+		p.httpGetters[peer] = p.newGetter(peer)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if !weighted {
+		p.addSorted()
+	}
+	p.epoch++
+}
+
+//addSorted 重建不支持权重的 p.peers，把 p.httpGetters 中的结点按地址排序后加入。
+//jump 等算法的结果与加入的顺序有关，结点以任意顺序加入、删除之后所有结点都要得到相同的映射，调用时需持有 p.mu
+func (p *HTTPPool) addSorted() {
+	sorted := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		sorted = append(sorted, peer)
+	}
+	sort.Strings(sorted)
+	p.peers = p.placement()
+	p.peers.Add(sorted...)
+}
+
+// RemovePeer 把 peers 从哈希环中删除，包括其所有虚拟结点，不在环上的结点会被忽略，哈希环发生变化时 epoch 加 1
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removePeers(peers...)
+}
+
+//removePeers 与 RemovePeer 相同，调用时需持有 p.mu
+func (p *HTTPPool) removePeers(peers ...string) {
+	changed := false
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		delete(p.httpGetters, peer)
+		p.peers.Remove(peer)
+		changed = true
+	}
+	if changed {
+		p.epoch++
+	}
 }
 
 //func (p *HTTPPool) ResponseStatus(w http.ResponseWriter, r *http.Request) {
@@ -72,17 +297,101 @@ func (p *HTTPPool) ListenSentinel(w http.ResponseWriter, r *http.Request) {
 //	w.Write([]byte("hello"))
 //}
 
+// ServeHTTP 实现了 http.Handler，是结点对外提供的全部接口：
+//	GET、DELETE、PUT basePath/<group>/<key>  获取、删除和写入缓存
+//	POST basePath/<group>                    批量获取，请求体是 pb.BatchRequest
+//	PUT /sentinel                            哨兵的通知
+//	/_stats、/_admin/peers、/metrics         统计信息、结点管理和 Prometheus 指标
+// group 和 key 需要经过 url.QueryEscape 编码，与 httpGetter 发出的请求一致。路径格式错误时返回 400
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/sentinel":
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPut, http.MethodPost)
+			return
+		}
+		p.ListenSentinel(w, r)
+		return
+	case "/_stats":
+		p.ServeStats(w, r)
+		return
+	case "/_admin/peers":
+		p.ServeAdminPeers(w, r)
+		return
+	case "/metrics":
+		p.ServeMetrics(w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, p.basePath) {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		p.GetKey(w, r)
+	case http.MethodDelete:
+		p.RemoveKey(w, r)
+	case http.MethodPut:
+		p.SetKey(w, r)
+	case http.MethodPost:
+		p.BatchGetKeys(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete, http.MethodPut, http.MethodPost)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+//parsePath 把 basePath 之后的路径按 "/" 切分为 n 段，每一段都用 url.QueryUnescape 解码并且不能为空。
+//使用编码后的路径切分，这样 key 中经过编码的 "/" 不会被当作分隔符
+func (p *HTTPPool) parsePath(r *http.Request, n int) ([]string, error) {
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, p.basePath) {
+		return nil, fmt.Errorf("unexpected path: %s", r.URL.Path)
+	}
+	parts := strings.Split(path[len(p.basePath):], "/")
+	if len(parts) != n {
+		if n == 1 {
+			return nil, fmt.Errorf("bad request: expected %s<group>", p.basePath)
+		}
+		return nil, fmt.Errorf("bad request: expected %s<group>/<key>", p.basePath)
+	}
+	for i, part := range parts {
+		s, err := url.QueryUnescape(part)
+		if err != nil {
+			return nil, fmt.Errorf("bad request: %v", err)
+		}
+		if s == "" {
+			return nil, fmt.Errorf("bad request: empty group or key in %s", r.URL.Path)
+		}
+		parts[i] = s
+	}
+	return parts, nil
+}
+
+//GetKey 处理其他结点发来的 GET 请求，路径为 basePath/<group>/<key>
 func (p *HTTPPool) GetKey(w http.ResponseWriter, r *http.Request) {
-	parts := strings.SplitN(r.URL.Path[len(defaultBasePath):], "/", 2)
-	groupName := parts[0]
-	key := parts[1]
-	group := GetGroup(groupName)
+	parts, err := p.parsePath(r, 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupName, key := parts[0], parts[1]
+	group := p.group(groupName)
 	if group == nil {
 		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
 		return
 	}
 
-	view, err := group.Get(key)
+	group.stats.ServerRequests.Add(1)
+	ctx, cancel := peerContext(r)
+	defer cancel()
+
+	view, err := group.GetContext(ctx, key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -100,28 +409,273 @@ func (p *HTTPPool) GetKey(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+//RemoveKey 处理其他结点发来的 DELETE 请求，只删除本结点上的缓存
+func (p *HTTPPool) RemoveKey(w http.ResponseWriter, r *http.Request) {
+	parts, err := p.parsePath(r, 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupName, key := parts[0], parts[1]
+	group := p.group(groupName)
+	if group == nil {
+		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.RemoveResponse{Removed: group.removeLocally(key)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+//maxSetBody 是 SetKey 请求体的最大字节数
+const maxSetBody = 16 << 20
+
+//SetKey 处理其他结点发来的 PUT 请求，请求体是 pb.Response，把推送过来的副本保存到本结点的 mainCache 中。
+//请求需要带上 AdminToken，只接受本结点是其副本结点的 key，否则返回 421
+func (p *HTTPPool) SetKey(w http.ResponseWriter, r *http.Request) {
+	if !p.checkAdmin(w, r) {
+		return
+	}
+	parts, err := p.parsePath(r, 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupName, key := parts[0], parts[1]
+	group := p.group(groupName)
+	if group == nil {
+		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
+		return
+	}
+	if !p.isReplica(key, group.replicas) {
+		http.Error(w, p.self + " is not a replica of " + key, http.StatusMisdirectedRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSetBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	value := &pb.Response{}
+	if err = proto.Unmarshal(body, value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.populateCache(key, ByteView{b: value.GetValue()})
+}
+
+//peerContext 返回处理其他结点请求使用的 ctx，带有 fromPeer 标记，并按照 timeoutHeader 设置请求方剩余的超时时间
+func peerContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := withFromPeer(r.Context())
+	if timeout, err := time.ParseDuration(r.Header.Get(timeoutHeader)); err == nil {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+//isReplica 判断本结点是否在 key 的 n 个主结点和副本结点中
+func (p *HTTPPool) isReplica(key string, n int) bool {
+	return n > 1 && containsPeer(p.PickReplicas(key, n), nil)
+}
+
+//BatchGetKeys 处理其他结点发来的 POST 请求，请求体是 pb.BatchRequest，路径为 basePath 加上 group 名称
+func (p *HTTPPool) BatchGetKeys(w http.ResponseWriter, r *http.Request) {
+	parts, err := p.parsePath(r, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupName := parts[0]
+	group := p.group(groupName)
+	if group == nil {
+		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.BatchRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group.stats.ServerRequests.Add(1)
+	ctx, cancel := peerContext(r)
+	defer cancel()
+	views, err := group.GetMultiContext(ctx, req.GetKeys())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := &pb.BatchResponse{Values: make(map[string][]byte, len(views))}
+	for k, v := range views {
+		res.Values[k] = v.ByteSlice()
+	}
+	body, err = proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+//ServeStats 以 JSON 格式返回统计信息，?group=name 只返回指定的 Group，否则返回所有已注册的 Group
+func (p *HTTPPool) ServeStats(w http.ResponseWriter, r *http.Request) {
+	var res []GroupStats
+	if name := r.URL.Query().Get("group"); name != "" {
+		group := p.group(name)
+		if group == nil {
+			http.Error(w, "no such group: " + name, http.StatusNotFound)
+			return
+		}
+		res = append(res, group.Stats())
+	} else {
+		for _, group := range allGroups() {
+			res = append(res, group.Stats())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 func (p *HTTPPool) Set(peers ...string) {
-	fmt.Println("func (p *HTTPPool) Set(peers ...string)")
+	weights := make(map[string]int, len(peers))
+	for _, peer := range peers {
+		weights[peer] = 1
+	}
+	p.SetWeighted(weights)
+}
+
+// SetWeighted 与 Set 相同，但每个结点带有权重，结点在哈希环上的虚拟结点数量与权重成正比，
+// 例如可以根据各个结点的内存大小设置权重
+func (p *HTTPPool) SetWeighted(weights map[string]int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	p.weights = make(map[string]int, len(weights))
+	for peer, weight := range weights {
+		p.weights[peer] = weight
+	}
+	p.epoch++
+	p.httpGetters = make(map[string]*httpGetter, len(weights))
+	for peer := range weights {
+		p.httpGetters[peer] = p.newGetter(peer)
 		//peer 类似:http://localhost:8001
 		//p.basePath类似:/_geecache/
 		//fmt.Printf("peer:%s p.basePath:%s\n", peer, p.basePath)
 	}
+	p.peers = p.placement()
+	//不支持权重的算法忽略权重
+	if wp, ok := p.peers.(placement.WeightedPlacement); ok {
+		wp.AddWeights(weights)
+	} else {
+		p.addSorted()
+	}
+}
+
+// SetPlacement 设置选择结点的算法，例如 placement.NewRendezvous，需要在 Set 之前调用。
+// 默认使用一致性哈希环(consistenthash.Map)，虚拟结点数和哈希函数由 HTTPPoolOptions 决定
+func (p *HTTPPool) SetPlacement(fn func() placement.Placement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.newPlacement = fn
+}
+
+//placement 创建新的 peers，调用时需持有 p.mu
+func (p *HTTPPool) placement() placement.Placement {
+	if p.newPlacement != nil {
+		return p.newPlacement()
+	}
+	return consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+}
+
+// SetBoundedLoad 开启有界负载的一致性哈希，epsilon 为 0 时关闭。开启后 PickPeer 会避开负载超过
+// (1+epsilon)×平均负载的结点。负载都是从本结点的角度统计的、交给该结点的尚未结束的请求数：
+// 远程结点是本结点发往它的请求，自己是本结点为自己的调用方在本地进行的加载，来自其他结点的请求不计入。
+// 被选中的结点即使不拥有 key 也会直接加载，不会再次转发。
+// 只有实现了 placement.BoundedPlacement 的算法支持有界负载，其他算法忽略这一设置
+func (p *HTTPPool) SetBoundedLoad(epsilon float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loadEpsilon = epsilon
+}
+
+// SetBreaker 设置每个远程结点的熔断器，ErrorRate 小于等于 0 时关闭熔断器。已有的熔断器会回到关闭状态
+func (p *HTTPPool) SetBreaker(cfg BreakerConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakerConfig = cfg
+	for _, stats := range p.peerStats {
+		stats.breaker.configure(cfg)
+	}
+}
+
+//available 判断 peer 是否可以接收请求，自己总是可用的，调用时需持有 p.mu
+func (p *HTTPPool) available(peer string) bool {
+	getter, ok := p.httpGetters[peer]
+	return peer == p.self || !ok || getter.stats.breaker.ready()
+}
+
+//loads 返回哈希环上每个结点当前的负载，调用时需持有 p.mu
+func (p *HTTPPool) loads() map[string]int64 {
+	loads := make(map[string]int64, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if getter.stats != nil {
+			loads[peer] = getter.stats.inflight.Get()
+		}
+	}
+	loads[p.self] = p.localInflight.Get()
+	return loads
+}
+
+//startLocal 实现了 localLoadTracker
+func (p *HTTPPool) startLocal() func() {
+	p.localInflight.Add(1)
+	return func() { p.localInflight.Add(-1) }
+}
+
+//statsOf 返回 peer 对应的计数器，调用时需持有 p.mu
+func (p *HTTPPool) statsOf(peer string) *peerStats {
+	if p.peerStats == nil {
+		p.peerStats = make(map[string]*peerStats)
+	}
+	stats, ok := p.peerStats[peer]
+	if !ok {
+		stats = &peerStats{breaker: newBreaker(p.breakerConfig)}
+		p.peerStats[peer] = stats
+	}
+	return stats
 }
 
 func (p *HTTPPool) PickPeer (key string) (PeerGetter, bool) {
-	fmt.Println("func (p *HTTPPool) PickPeer (key string) (PeerGetter, bool)")
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if peer := p.peers.Get(key); peer != "" && peer != p.self{
+	var peer string
+	if bp, ok := p.peers.(placement.BoundedPlacement); ok && p.loadEpsilon > 0 {
+		peer = bp.GetBounded(key, p.loads(), p.loadEpsilon)
+	} else {
+		peer = p.peers.Get(key)
+	}
+	if peer != "" && !p.available(peer) {
+		p.Log("Circuit breaker of %s is open", peer)
+		peer = p.nextAvailable(key)
+	}
+	if peer != "" && peer != p.self{
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	} else  {
@@ -130,9 +684,57 @@ func (p *HTTPPool) PickPeer (key string) (PeerGetter, bool) {
 	}
 }
 
+//nextAvailable 沿着哈希环寻找 key 的下一个熔断器没有打开的结点，选择算法没有实现 placement.ReplicatedPlacement
+//或者所有远程结点都不可用时返回空字符串，由本结点加载。调用时需持有 p.mu
+func (p *HTTPPool) nextAvailable(key string) string {
+	rp, ok := p.peers.(placement.ReplicatedPlacement)
+	if !ok {
+		return ""
+	}
+	for _, peer := range rp.GetN(key, len(p.httpGetters)) {
+		if p.available(peer) {
+			return peer
+		}
+	}
+	return ""
+}
+
+// PickReplicas 实现了 ReplicaPicker，选择算法没有实现 placement.ReplicatedPlacement 时只返回主结点，
+// 熔断器打开的结点不会出现在结果中
+func (p *HTTPPool) PickReplicas(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+
+	var owners []string
+	if rp, ok := p.peers.(placement.ReplicatedPlacement); ok {
+		owners = rp.GetN(key, n)
+	} else if owner := p.peers.Get(key); owner != "" {
+		owners = []string{owner}
+	}
+	res := make([]PeerGetter, 0, len(owners))
+	for _, owner := range owners {
+		if !p.available(owner) {
+			continue
+		}
+		if getter, ok := p.httpGetters[owner]; ok && owner != p.self {
+			res = append(res, getter)
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res
+}
+
 //httpGetter 是客户端类,实现PeerGetter接口
 type httpGetter struct {
 	baseURL string	//baseURL 表示将要访问的远程节点的地址，例如 http://example.com/_geecache/
+	stats *peerStats	//与该远程结点之间的请求统计
+	client *http.Client	//为 nil 时使用 http.DefaultClient
+	timeout time.Duration	//每个请求的超时时间，小于等于 0 时不设置
+	token string	//推送副本时带上的 AdminToken
 }
 
 // 未使用gRPC的Get方法
@@ -163,24 +765,50 @@ type httpGetter struct {
 
 //使用了gRPC的Get方法
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	fmt.Println("func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error ")
+	return h.GetContext(context.Background(), in, out)
+}
+
+//GetContext 与 Get 相同，请求会随 ctx 取消，ctx 的剩余时间通过 timeoutHeader 发送给远程结点
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) (err error) {
+	start, err := h.start()
+	if err != nil {
+		return err
+	}
+	defer func() { h.record(err, start) }()
 	u := fmt.Sprintf("%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 		)
 
-	res, err := http.Get(u)
+	bytes, err := h.roundTrip(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	if err = proto.Unmarshal(bytes, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+	return nil
+}
+
+//Remove 向远程结点发送 DELETE 请求，删除其上 key 对应的缓存
+func (h *httpGetter) Remove(in *pb.Request, out *pb.RemoveResponse) (err error) {
+	start, err := h.start()
+	if err != nil {
+		return err
 	}
+	defer func() { h.record(err, start) }()
+	u := fmt.Sprintf("%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
+		)
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	bytes, err := h.roundTrip(context.Background(), http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
 	if err = proto.Unmarshal(bytes, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
@@ -188,7 +816,146 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+//Set 把 value 编码后 PUT 给远程结点，保存为其 mainCache 中 key 的副本
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request, value *pb.Response) (err error) {
+	start, err := h.start()
+	if err != nil {
+		return err
+	}
+	defer func() { h.record(err, start) }()
+	body, err := proto.Marshal(value)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
+		)
+
+	_, err = h.roundTrip(ctx, http.MethodPut, u, body)
+	return err
+}
+
+//GetMulti 把 in 编码后 POST 给远程结点，一次获取多个 key
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) (err error) {
+	start, err := h.start()
+	if err != nil {
+		return err
+	}
+	defer func() { h.record(err, start) }()
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u := h.baseURL + url.QueryEscape(in.GetGroup())
+
+	body, err = h.roundTrip(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+
+	return nil
+}
+
+//roundTrip 向 u 发送 method 请求，body 不为 nil 时作为请求体，返回完整的响应体，响应不是 200 时返回错误。
+//h.timeout 大于 0 时请求最多持续 h.timeout，ctx 的剩余时间通过 timeoutHeader 发送给远程结点。
+//响应体总是被读完并关闭，这样连接可以放回连接池复用
+func (h *httpGetter) roundTrip(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if method == http.MethodPut && h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, time.Until(deadline).String())
+	}
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	return data, nil
+}
+
+//maxDrain 是 drainAndClose 最多读取的字节数，剩余更多时直接关闭连接比读完更便宜
+const maxDrain = 4 << 10
+
+//drainAndClose 最多读取 maxDrain 字节剩余的响应体再关闭，读完的连接可以被复用，
+//没有读完时 Close 会关闭连接，避免为了复用连接读取很大或者很慢的响应体
+func drainAndClose(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxDrain)
+	body.Close()
+}
+
+//start 记录一个开始的请求，请求结束时需要调用 record。熔断器打开时返回 ErrBreakerOpen，请求不应发出
+func (h *httpGetter) start() (time.Time, error) {
+	if h.stats == nil {
+		return time.Now(), nil
+	}
+	if !h.stats.breaker.allow() {
+		return time.Time{}, ErrBreakerOpen
+	}
+	h.stats.inflight.Add(1)
+	return time.Now(), nil
+}
+
+//record 记录一次对远程结点的请求及其是否失败，同时更新熔断器
+func (h *httpGetter) record(err error, start time.Time) {
+	if h.stats == nil {
+		return
+	}
+	h.stats.inflight.Add(-1)
+	h.stats.requests.Add(1)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		h.stats.errors.Add(1)
+	}
+	h.stats.breaker.record(err, time.Since(start))
+}
 
 var _ PeerGetter = (*httpGetter)(nil)
 
+var _ ContextPeerGetter = (*httpGetter)(nil)
+
+var _ BatchPeerGetter = (*httpGetter)(nil)
+
+var _ PeerRemover = (*httpGetter)(nil)
+
+var _ PeerSetter = (*httpGetter)(nil)
+
 var _ PeerPicker = (*HTTPPool)(nil)
+
+var _ http.Handler = (*HTTPPool)(nil)
+
+var _ ReplicaPicker = (*HTTPPool)(nil)
+
+var _ localLoadTracker = (*HTTPPool)(nil)
@@ -0,0 +1,336 @@
+package geecache
+
+import (
+	"bytes"
+	"cache/geecache/consistenthash"
+	"cache/geecache/pb"
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//countingTransport 统计经过的请求数
+type countingTransport struct {
+	mu       sync.Mutex
+	requests []string
+	next     http.RoundTripper
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req.URL.Path)
+	c.mu.Unlock()
+	return c.next.RoundTrip(req)
+}
+
+func TestHTTPPoolOpts(t *testing.T) {
+	transport := &countingTransport{next: newTransport(0)}
+	hashed := 0
+	pool := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{
+		BasePath:  "/cache/",
+		Replicas:  7,
+		HashFn:    func(data []byte) uint32 { hashed++; return uint32(len(data)) },
+		Transport: transport,
+	})
+	if pool.basePath != "/cache/" || pool.opts.Timeout != defaultTimeout {
+		t.Fatalf("unexpected options %+v", pool.opts)
+	}
+
+	group := newGroup("opts", 2 << 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	pool.getGroup = func(string) *Group { return group }
+	server := httptest.NewServer(http.HandlerFunc(pool.GetKey))
+	defer server.Close()
+
+	pool.Set("http://localhost:8001", server.URL)
+	if hashed != 2*7 {
+		t.Fatalf("ring should use HashFn with 7 replicas per node, hashed %d times", hashed)
+	}
+	if got := pool.peers.(*consistenthash.Map).Nodes(); len(got) != 2 {
+		t.Fatalf("unexpected nodes %v", got)
+	}
+
+	res := &pb.Response{}
+	if err := pool.httpGetters[server.URL].Get(&pb.Request{Group: "opts", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "value of Tom" {
+		t.Fatalf("unexpected value %q", res.Value)
+	}
+	if len(transport.requests) != 1 || transport.requests[0] != "/cache/opts/Tom" {
+		t.Fatalf("request should go through the custom transport with BasePath, got %v", transport.requests)
+	}
+}
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//请求方的剩余时间通过 timeoutHeader 传给远程结点
+		if _, err := time.ParseDuration(r.Header.Get(timeoutHeader)); err != nil {
+			t.Errorf("missing %s header", timeoutHeader)
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	pool := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{Timeout: 50 * time.Millisecond})
+	pool.Set(server.URL)
+	start := time.Now()
+	err := pool.httpGetters[server.URL].GetContext(context.Background(), &pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+	if err == nil {
+		t.Fatal("slow peer should time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request should be canceled after the timeout, took %v", elapsed)
+	}
+}
+
+func TestHTTPGetterReusesConnections(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  int
+		conns int
+	}{
+		//错误响应的响应体不超过 maxDrain 时被读完，连接可以复用
+		{"small body", maxDrain, 1},
+		//响应体太大时不再读完，直接关闭连接
+		{"large body", 1 << 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			conns := 0
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(strings.Repeat("x", tt.body)))
+			}))
+			server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					mu.Lock()
+					conns++
+					mu.Unlock()
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			pool := NewHTTPPool("http://localhost:8001")
+			pool.SetBreaker(BreakerConfig{})
+			pool.Set(server.URL)
+			getter := pool.httpGetters[server.URL]
+			for i := 0; i < 10; i++ {
+				if err := getter.Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{}); err == nil {
+					t.Fatal("expected an error response")
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if conns != tt.conns {
+				t.Fatalf("expected %d connections, opened %d", tt.conns, conns)
+			}
+		})
+	}
+}
+
+//testAdminToken 是 startTestPool 中结点的 AdminToken
+const testAdminToken = "secret"
+
+//startTestPool 启动一个只有自己的结点，其 Group 对任何 key 都返回 "value of <key>"，每个 key 保存在两个结点上
+func startTestPool(t *testing.T) (*HTTPPool, *Group, *httptest.Server) {
+	group := newGroup("scores", 2 << 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}), WithReplication(2, false))
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{AdminToken: testAdminToken})
+	pool.getGroup = func(name string) *Group {
+		if name == group.name {
+			return group
+		}
+		return nil
+	}
+	server := httptest.NewServer(pool)
+	t.Cleanup(server.Close)
+	pool.self = server.URL
+	return pool, group, server
+}
+
+func TestServeHTTP(t *testing.T) {
+	pool, _, server := startTestPool(t)
+	pool.Set(server.URL)
+	batch, err := proto.Marshal(&pb.BatchRequest{Group: "scores", Keys: []string{"Tom", "Jack"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(&pb.Response{Value: []byte("pushed")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		method string
+		path   string
+		body   []byte
+		code   int
+	}{
+		{http.MethodGet, "/_geecache/scores/Tom", nil, http.StatusOK},
+		{http.MethodDelete, "/_geecache/scores/Tom", nil, http.StatusOK},
+		{http.MethodPost, "/_geecache/scores", batch, http.StatusOK},
+		{http.MethodPut, "/_geecache/scores/Tom", value, http.StatusOK},
+		{http.MethodGet, "/_stats", nil, http.StatusOK},
+		{http.MethodGet, "/metrics", nil, http.StatusOK},
+		{http.MethodGet, "/_admin/peers", nil, http.StatusOK},
+		//路径格式错误
+		{http.MethodGet, "/_geecache/scores", nil, http.StatusBadRequest},
+		{http.MethodGet, "/_geecache/scores/", nil, http.StatusBadRequest},
+		{http.MethodGet, "/_geecache//Tom", nil, http.StatusBadRequest},
+		{http.MethodGet, "/_geecache/scores/Tom/extra", nil, http.StatusBadRequest},
+		{http.MethodGet, "/_geecache/", nil, http.StatusBadRequest},
+		{http.MethodDelete, "/_geecache/scores", nil, http.StatusBadRequest},
+		{http.MethodPut, "/_geecache/scores/", nil, http.StatusBadRequest},
+		{http.MethodPost, "/_geecache/scores/Tom", batch, http.StatusBadRequest},
+		{http.MethodPost, "/_geecache/scores/", batch, http.StatusBadRequest},
+		//不存在的 group 和路径
+		{http.MethodGet, "/_geecache/courses/Tom", nil, http.StatusNotFound},
+		{http.MethodGet, "/api", nil, http.StatusNotFound},
+		{http.MethodGet, "/_geecachex/scores/Tom", nil, http.StatusNotFound},
+		//不支持的方法
+		{http.MethodPatch, "/_geecache/scores/Tom", nil, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/sentinel", nil, http.StatusMethodNotAllowed},
+	}
+	for _, c := range testCases {
+		var body io.Reader
+		if c.body != nil {
+			body = bytes.NewReader(c.body)
+		}
+		req, err := http.NewRequest(c.method, server.URL+c.path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainAndClose(res.Body)
+		if res.StatusCode != c.code {
+			t.Errorf("%s %s returned %d, want %d", c.method, c.path, res.StatusCode, c.code)
+		}
+		if c.code == http.StatusMethodNotAllowed && res.Header.Get("Allow") == "" {
+			t.Errorf("%s %s should set the Allow header", c.method, c.path)
+		}
+	}
+}
+
+func TestSetKey(t *testing.T) {
+	pool, group, server := startTestPool(t)
+	//使用固定的地址，保证哈希环上既有本结点保存的 key，也有不保存的 key
+	pool.self = "http://localhost:8001"
+	pool.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	value, err := proto.Marshal(&pb.Response{Value: []byte("pushed")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replicaKey, otherKey string
+	for i := 0; replicaKey == "" || otherKey == ""; i++ {
+		if i == 1000 {
+			t.Fatal("the ring should have keys on both sides")
+		}
+		key := fmt.Sprintf("key%d", i)
+		if pool.isReplica(key, 2) {
+			replicaKey = key
+		} else {
+			otherKey = key
+		}
+	}
+
+	put := func(key, auth string, body []byte) int {
+		req, err := http.NewRequest(http.MethodPut, server.URL+defaultBasePath+"scores/"+key, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainAndClose(res.Body)
+		return res.StatusCode
+	}
+	if code := put(replicaKey, "", value); code != http.StatusUnauthorized {
+		t.Fatalf("PUT without a token returned %d", code)
+	}
+	if code := put(replicaKey, "wrong", value); code != http.StatusUnauthorized {
+		t.Fatalf("PUT with a wrong token returned %d", code)
+	}
+	//只接受本结点是副本结点的 key
+	if code := put(otherKey, testAdminToken, value); code != http.StatusMisdirectedRequest {
+		t.Fatalf("PUT for a key this node does not keep returned %d", code)
+	}
+	big, err := proto.Marshal(&pb.Response{Value: make([]byte, maxSetBody)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := put(replicaKey, testAdminToken, big); code != http.StatusBadRequest {
+		t.Fatalf("PUT with a body over maxSetBody returned %d", code)
+	}
+	if group.CacheStats(MainCache).Items != 0 {
+		t.Fatal("rejected values should not be cached")
+	}
+	if code := put(replicaKey, testAdminToken, value); code != http.StatusOK {
+		t.Fatalf("PUT for a replica returned %d", code)
+	}
+	if v, ok := group.mainCache.get(replicaKey); !ok || v.String() != "pushed" {
+		t.Fatalf("pushed value should be cached, got %q", v.String())
+	}
+}
+
+func TestServeHTTPUnescape(t *testing.T) {
+	pool, group, server := startTestPool(t)
+	pool.Set(server.URL)
+	getter := pool.httpGetters[server.URL]
+
+	//httpGetter 用 url.QueryEscape 编码 group 和 key，服务端需要解码出原来的 key
+	for _, key := range []string{"Tom", "a b", "a/b", "100%", "a+b", "键?x=1&y#z"} {
+		res := &pb.Response{}
+		if err := getter.Get(&pb.Request{Group: "scores", Key: key}, res); err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if string(res.Value) != "value of "+key {
+			t.Errorf("Get(%q) returned %q", key, res.Value)
+		}
+	}
+
+	//写入和删除使用同样的编码
+	if err := getter.Set(context.Background(), &pb.Request{Group: "scores", Key: "a/b c"}, &pb.Response{Value: []byte("pushed")}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := group.mainCache.get("a/b c"); !ok || v.String() != "pushed" {
+		t.Fatalf("pushed value should be stored under the unescaped key, got %q", v.String())
+	}
+	removed := &pb.RemoveResponse{}
+	if err := getter.Remove(&pb.Request{Group: "scores", Key: "a/b c"}, removed); err != nil || !removed.Removed {
+		t.Fatalf("Remove returned %v, %v", removed.Removed, err)
+	}
+
+	out := &pb.BatchResponse{}
+	if err := getter.GetMulti(context.Background(), &pb.BatchRequest{Group: "scores", Keys: []string{"x y", "z/w"}}, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Values["x y"]) != "value of x y" || string(out.Values["z/w"]) != "value of z/w" {
+		t.Fatalf("unexpected batch response %v", out.Values)
+	}
+}
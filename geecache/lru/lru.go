@@ -1,6 +1,33 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
+
+//EvictReason 表示一条记录被移除的原因，会随 OnEvictedReason 回调一起传出
+type EvictReason int
+
+const (
+	//EvictCapacity 表示超出 maxBytes 后被淘汰的最近最少访问记录
+	EvictCapacity EvictReason = iota
+	//EvictExpired 表示记录已经过期，在 Get 或者 RemoveExpired 时被移除
+	EvictExpired
+	//EvictRemoved 表示记录被 Remove 主动删除
+	EvictRemoved
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
 
 type Cache struct {
 	//允许的最大内存
@@ -11,12 +38,18 @@ type Cache struct {
 	cache map[string]*list.Element
 	//某条记录被移除的回调函数，可以是nil
 	OnEvicted func(key string, value Value)
+	//与 OnEvicted 相同，但同时传出记录被移除的原因，可以是nil
+	OnEvictedReason func(key string, value Value, reason EvictReason)
+	//now 返回当前时间，便于测试时替换
+	now func() time.Time
 }
 
 //entry 是双线链表结点的数据类型，保存key是便于在删除首节点时可以找到key
 type entry struct {
 	key string
 	value Value
+	//expire 为过期时间，零值表示永不过期
+	expire time.Time
 }
 
 //Value 接口只有一个 Len 函数是为了保证通用性，即实现了 Value 接口的任意类型
@@ -32,14 +65,27 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 		ll: list.New(),
 		cache: make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		now: time.Now,
 	}
 }
 
+//NewWithReason 与 New 相同，但回调函数会收到记录被移除的原因
+func NewWithReason(maxBytes int64, onEvicted func(string, Value, EvictReason)) *Cache {
+	c := New(maxBytes, nil)
+	c.OnEvictedReason = onEvicted
+	return c
+}
+
 //Get 实现从字典中找到对应的双向链表的结点，然后将其移动到队首
+//如果结点已经过期则惰性删除，并当作未命中处理
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		if c.expired(kv) {
+			c.removeElement(ele, EvictExpired)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
@@ -49,26 +95,66 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+
+// Remove 删除 key 对应的结点，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired 遍历所有结点，移除其中已经过期的，返回移除的条数
+func (c *Cache) RemoveExpired() int {
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if c.expired(ele.Value.(*entry)) {
+			c.removeElement(ele, EvictExpired)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+	if c.OnEvictedReason != nil {
+		c.OnEvictedReason(kv.key, kv.value, reason)
 	}
 }
 
+func (c *Cache) expired(kv *entry) bool {
+	return !kv.expire.IsZero() && !c.now().Before(kv.expire)
+}
+
 // Add 函数用于增加/修改
 // 如果key存在则更新对应结点的值，并将该结点移到队首; 不存在则代表新结点，向字典中添加
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpiry(key, value, time.Time{})
+}
+
+// AddWithExpiry 与 Add 相同，但记录会在 expire 时刻过期，expire 为零值表示永不过期
+func (c *Cache) AddWithExpiry(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -77,7 +163,21 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// AddWithTTL 添加一条在 ttl 之后过期的记录，ttl <= 0 表示永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.AddWithExpiry(key, value, expire)
+}
+
+// Bytes 获取当前使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 // Len 获取数据条数
 func (c *Cache) Len() int {
 	return c.ll.Len()
-}
\ No newline at end of file
+}
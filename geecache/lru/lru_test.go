@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -23,6 +24,23 @@ func TestGet (t *testing.T) {
 	}
 }
 
+func TestRemove(t *testing.T) {
+	var reason EvictReason
+	lru := NewWithReason(int64(0), func(key string, value Value, r EvictReason) {
+		reason = r
+	})
+	lru.Add("key1", String("1234"))
+	if !lru.Remove("key1") || reason != EvictRemoved {
+		t.Fatal("remove key1 failed")
+	}
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 0 {
+		t.Fatal("key1 should be removed")
+	}
+	if lru.Remove("key1") {
+		t.Fatal("remove missing key1 should return false")
+	}
+}
+
 func TestRemoveOldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "key3"
 	v1, v2, v3 := "value1", "value2", "value3"
@@ -54,4 +72,59 @@ func TestOnEvicted(t *testing.T) {
 	if !reflect.DeepEqual(expect, keys) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
+}
+
+func TestOnEvictedReason(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value, reason EvictReason) {
+		if reason != EvictCapacity {
+			t.Fatalf("evict %s with reason %s, expect capacity", key, reason)
+		}
+		keys = append(keys, key)
+	}
+	lru := NewWithReason(int64(10), callback)
+	lru.Add("key1", String("123456"))
+	lru.Add("k2", String("k2"))
+	lru.Add("k3", String("k3"))
+	lru.Add("k4", String("k4"))
+
+	if expect := []string{"key1", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvictedReason failed, expect keys equals to %s", expect)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	reasons := make(map[string]EvictReason)
+	lru := NewWithReason(int64(0), func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	lru.now = func() time.Time { return now }
+
+	lru.AddWithTTL("key1", String("1234"), time.Second)
+	lru.AddWithExpiry("key2", String("5678"), now.Add(time.Minute))
+	lru.Add("key3", String("forever"))
+
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatal("key1 should not expire yet")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatal("key1 should have expired")
+	}
+	if reasons["key1"] != EvictExpired || lru.Len() != 2 {
+		t.Fatalf("lazy expire key1 failed, reasons %v len %d", reasons, lru.Len())
+	}
+
+	now = now.Add(time.Hour)
+	if n := lru.RemoveExpired(); n != 1 {
+		t.Fatalf("RemoveExpired removed %d entries, expect 1", n)
+	}
+	if _, ok := reasons["key2"]; !ok || lru.Len() != 1 {
+		t.Fatal("RemoveExpired key2 failed")
+	}
+	if _, ok := lru.Get("key3"); !ok {
+		t.Fatal("key3 without expiry should never expire")
+	}
 }
\ No newline at end of file
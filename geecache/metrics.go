@@ -0,0 +1,192 @@
+package geecache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//defaultBuckets 是延迟直方图的上界，单位为秒，与 Prometheus 客户端的默认值相同。使用数组，histogram 的长度可以由它推出
+var defaultBuckets = [...]float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//histogram 是并发安全的延迟直方图，counts[i] 记录落在 (defaultBuckets[i-1], defaultBuckets[i]] 中的次数，
+//最后一个元素记录超过所有上界的次数，所以长度为 len(defaultBuckets)+1
+type histogram struct {
+	counts [len(defaultBuckets) + 1]AtomicInt
+	sum    AtomicInt //所有观测值之和，单位为纳秒
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(defaultBuckets[:], seconds)
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+//since 记录从 start 到现在的耗时，便于与 defer 一起使用
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+//peerStats 是 HTTPPool 中每个远程结点的计数器，在 Set 之后依然保留
+type peerStats struct {
+	requests AtomicInt
+	errors   AtomicInt
+	inflight AtomicInt //已经发出但还没有结束的请求数
+	breaker  *breaker
+}
+
+// ServeMetrics 以 Prometheus 文本格式输出所有已注册 Group 的指标以及本结点访问各远程结点的错误数
+func (p *HTTPPool) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	peers := make(map[string]*peerStats, len(p.peerStats))
+	for peer, stats := range p.peerStats {
+		peers[peer] = stats
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, allGroups(), peers)
+}
+
+//metricWriter 负责按照 Prometheus 文本格式写出指标
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m metricWriter) header(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (m metricWriter) sample(name string, value int64, labels ...string) {
+	fmt.Fprintf(m.w, "%s%s %d\n", name, formatLabels(labels), value)
+}
+
+func (m metricWriter) histogram(name string, h *histogram, labels ...string) {
+	var cumulative int64
+	for i, le := range defaultBuckets {
+		cumulative += h.counts[i].Get()
+		m.sample(name+"_bucket", cumulative, append(labels, "le", strconv.FormatFloat(le, 'g', -1, 64))...)
+	}
+	cumulative += h.counts[len(defaultBuckets)].Get()
+	m.sample(name+"_bucket", cumulative, append(labels, "le", "+Inf")...)
+	fmt.Fprintf(m.w, "%s_sum%s %g\n", name, formatLabels(labels), time.Duration(h.sum.Get()).Seconds())
+	m.sample(name+"_count", cumulative, labels...)
+}
+
+//formatLabels 把 name1, value1, name2, value2... 格式化为 {name1="value1",name2="value2"}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+//groupCounters 列出 Group 中需要导出的计数器
+var groupCounters = []struct {
+	name string
+	help string
+	get  func(s *Stats) *AtomicInt
+}{
+	{"geecache_gets_total", "Number of Get requests, including requests from peers.", func(s *Stats) *AtomicInt { return &s.Gets }},
+	{"geecache_cache_hits_total", "Number of Get requests served by mainCache or hotCache.", func(s *Stats) *AtomicInt { return &s.CacheHits }},
+	{"geecache_peer_loads_total", "Number of values loaded from peers.", func(s *Stats) *AtomicInt { return &s.PeerLoads }},
+	{"geecache_peer_errors_total", "Number of failed loads from peers.", func(s *Stats) *AtomicInt { return &s.PeerErrors }},
+	{"geecache_loads_total", "Number of cache misses that needed a load.", func(s *Stats) *AtomicInt { return &s.Loads }},
+	{"geecache_loads_deduped_total", "Number of loads after singleflight deduplication.", func(s *Stats) *AtomicInt { return &s.LoadsDeduped }},
+	{"geecache_local_loads_total", "Number of values loaded by the Getter.", func(s *Stats) *AtomicInt { return &s.LocalLoads }},
+	{"geecache_local_load_errors_total", "Number of failed loads by the Getter.", func(s *Stats) *AtomicInt { return &s.LocalLoadErrs }},
+	{"geecache_server_requests_total", "Number of requests received from peers.", func(s *Stats) *AtomicInt { return &s.ServerRequests }},
+	{"geecache_replica_loads_total", "Number of values loaded from replicas after the primary failed.", func(s *Stats) *AtomicInt { return &s.ReplicaLoads }},
+	{"geecache_failover_loads_total", "Number of values loaded from the next peers after the owner failed.", func(s *Stats) *AtomicInt { return &s.FailoverLoads }},
+	{"geecache_hedges_sent_total", "Number of hedged requests sent after the owner did not answer in time.", func(s *Stats) *AtomicInt { return &s.HedgesSent }},
+	{"geecache_hedges_won_total", "Number of hedged requests that answered before the original request.", func(s *Stats) *AtomicInt { return &s.HedgesWon }},
+}
+
+//writeMetrics 输出 groups 和 peers 的全部指标，输出顺序固定，便于比较
+func writeMetrics(w io.Writer, groups []*Group, peers map[string]*peerStats) error {
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	m := metricWriter{w: bufio.NewWriter(w)}
+
+	for _, c := range groupCounters {
+		m.header(c.name, "counter", c.help)
+		for _, g := range groups {
+			m.sample(c.name, c.get(&g.stats).Get(), "group", g.name)
+		}
+	}
+
+	caches := make([][2]CacheStats, len(groups))
+	for i, g := range groups {
+		caches[i] = [2]CacheStats{g.mainCache.stats(), g.hotCache.stats()}
+	}
+	cacheMetrics := []struct {
+		name string
+		typ  string
+		help string
+		get  func(s CacheStats) int64
+	}{
+		{"geecache_cache_bytes", "gauge", "Bytes used by the cache.", func(s CacheStats) int64 { return s.Bytes }},
+		{"geecache_cache_items", "gauge", "Number of items in the cache.", func(s CacheStats) int64 { return s.Items }},
+		{"geecache_cache_gets_total", "counter", "Number of lookups in the cache.", func(s CacheStats) int64 { return s.Gets }},
+		{"geecache_cache_lookup_hits_total", "counter", "Number of lookups that hit the cache.", func(s CacheStats) int64 { return s.Hits }},
+		{"geecache_cache_evictions_total", "counter", "Number of items evicted for capacity or expiry.", func(s CacheStats) int64 { return s.Evictions }},
+	}
+	for _, c := range cacheMetrics {
+		m.header(c.name, c.typ, c.help)
+		for i, g := range groups {
+			m.sample(c.name, c.get(caches[i][0]), "group", g.name, "cache", "main")
+			m.sample(c.name, c.get(caches[i][1]), "group", g.name, "cache", "hot")
+		}
+	}
+
+	m.header("geecache_load_duration_seconds", "histogram", "Latency of loads from the Getter and from peers.")
+	for _, g := range groups {
+		m.histogram("geecache_load_duration_seconds", &g.localLatency, "group", g.name, "source", "local")
+		m.histogram("geecache_load_duration_seconds", &g.peerLatency, "group", g.name, "source", "peer")
+	}
+
+	names := make([]string, 0, len(peers))
+	for peer := range peers {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	m.header("geecache_peer_requests_total", "counter", "Number of requests sent to each peer.")
+	for _, peer := range names {
+		m.sample("geecache_peer_requests_total", peers[peer].requests.Get(), "peer", peer)
+	}
+	m.header("geecache_peer_request_errors_total", "counter", "Number of failed requests sent to each peer.")
+	for _, peer := range names {
+		m.sample("geecache_peer_request_errors_total", peers[peer].errors.Get(), "peer", peer)
+	}
+	m.header("geecache_peer_inflight_requests", "gauge", "Number of requests sent to each peer that have not finished.")
+	for _, peer := range names {
+		m.sample("geecache_peer_inflight_requests", peers[peer].inflight.Get(), "peer", peer)
+	}
+	m.header("geecache_peer_breaker_state", "gauge", "State of the circuit breaker of each peer: 0 closed, 1 open, 2 half-open.")
+	for _, peer := range names {
+		if b := peers[peer].breaker; b != nil {
+			m.sample("geecache_peer_breaker_state", int64(b.current()), "peer", peer)
+		}
+	}
+
+	return m.w.Flush()
+}
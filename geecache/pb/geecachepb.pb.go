@@ -110,9 +110,138 @@ func (m *Response) GetValue() []byte {
 	return nil
 }
 
+type RemoveResponse struct {
+	Removed              bool     `protobuf:"varint,1,opt,name=removed,proto3" json:"removed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveResponse) Reset()         { *m = RemoveResponse{} }
+func (m *RemoveResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveResponse) ProtoMessage()    {}
+func (*RemoveResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{2}
+}
+
+func (m *RemoveResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveResponse.Unmarshal(m, b)
+}
+func (m *RemoveResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveResponse.Marshal(b, m, deterministic)
+}
+func (m *RemoveResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveResponse.Merge(m, src)
+}
+func (m *RemoveResponse) XXX_Size() int {
+	return xxx_messageInfo_RemoveResponse.Size(m)
+}
+func (m *RemoveResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveResponse proto.InternalMessageInfo
+
+func (m *RemoveResponse) GetRemoved() bool {
+	if m != nil {
+		return m.Removed
+	}
+	return false
+}
+
+type BatchRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys                 []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{3}
+}
+
+func (m *BatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchRequest.Unmarshal(m, b)
+}
+func (m *BatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchRequest.Merge(m, src)
+}
+func (m *BatchRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchRequest.Size(m)
+}
+func (m *BatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchRequest proto.InternalMessageInfo
+
+func (m *BatchRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *BatchRequest) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+type BatchResponse struct {
+	Values               map[string][]byte `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *BatchResponse) Reset()         { *m = BatchResponse{} }
+func (m *BatchResponse) String() string { return proto.CompactTextString(m) }
+func (*BatchResponse) ProtoMessage()    {}
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{4}
+}
+
+func (m *BatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchResponse.Unmarshal(m, b)
+}
+func (m *BatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchResponse.Marshal(b, m, deterministic)
+}
+func (m *BatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchResponse.Merge(m, src)
+}
+func (m *BatchResponse) XXX_Size() int {
+	return xxx_messageInfo_BatchResponse.Size(m)
+}
+func (m *BatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchResponse proto.InternalMessageInfo
+
+func (m *BatchResponse) GetValues() map[string][]byte {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Request)(nil), "pb.Request")
 	proto.RegisterType((*Response)(nil), "pb.Response")
+	proto.RegisterType((*RemoveResponse)(nil), "pb.RemoveResponse")
+	proto.RegisterType((*BatchRequest)(nil), "pb.BatchRequest")
+	proto.RegisterType((*BatchResponse)(nil), "pb.BatchResponse")
+	proto.RegisterMapType((map[string][]byte)(nil), "pb.BatchResponse.ValuesEntry")
 }
 
 func init() {
@@ -120,17 +249,26 @@ func init() {
 }
 
 var fileDescriptor_889d0a4ad37a0d42 = []byte{
-	// 158 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x48, 0x4f, 0x4d, 0x4d,
-	0x4e, 0x4c, 0xce, 0x48, 0x2d, 0x48, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48,
-	0x52, 0x32, 0xe4, 0x62, 0x0f, 0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x11, 0x12, 0xe1, 0x62, 0x4d,
-	0x2f, 0xca, 0x2f, 0x2d, 0x90, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0c, 0x82, 0x70, 0x84, 0x04, 0xb8,
-	0x98, 0xb3, 0x53, 0x2b, 0x25, 0x98, 0xc0, 0x62, 0x20, 0xa6, 0x92, 0x02, 0x17, 0x47, 0x50, 0x6a,
-	0x71, 0x41, 0x7e, 0x5e, 0x71, 0x2a, 0x48, 0x4f, 0x59, 0x62, 0x4e, 0x69, 0x2a, 0x58, 0x0f, 0x4f,
-	0x10, 0x84, 0x63, 0xa4, 0xc7, 0xc5, 0xe5, 0x0e, 0xd2, 0xec, 0x0c, 0xb2, 0x4e, 0x48, 0x81, 0x8b,
-	0xd9, 0x3d, 0xb5, 0x44, 0x88, 0x5b, 0xaf, 0x20, 0x49, 0x0f, 0x6a, 0x97, 0x14, 0x0f, 0x84, 0x03,
-	0x31, 0xc5, 0x89, 0x3d, 0x8a, 0x55, 0x4f, 0x4f, 0xbf, 0x20, 0x29, 0x89, 0x0d, 0xec, 0x30, 0x63,
-	0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0x7f, 0x22, 0x66, 0x40, 0xac, 0x00, 0x00, 0x00,
+	// 293 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x91, 0xb1, 0x4f, 0x83, 0x40,
+	0x14, 0xc6, 0x73, 0x60, 0x0b, 0x7d, 0xa0, 0xc1, 0x8b, 0x03, 0x69, 0x62, 0x42, 0x98, 0xd0, 0xe1,
+	0x1a, 0x6b, 0x4c, 0xaa, 0x63, 0x8d, 0x61, 0x72, 0xb9, 0xc1, 0xc1, 0x0d, 0xf0, 0xa5, 0x35, 0xad,
+	0xe5, 0x84, 0xa3, 0x09, 0xa3, 0xab, 0x7f, 0xb5, 0xe1, 0xee, 0x5a, 0x21, 0x26, 0x6e, 0xf7, 0x3d,
+	0xbe, 0x2f, 0xef, 0xfb, 0x3d, 0x20, 0x58, 0x21, 0x16, 0x59, 0xb1, 0x46, 0x91, 0x33, 0x51, 0x95,
+	0xb2, 0xa4, 0x96, 0xc8, 0xe3, 0x1b, 0x70, 0x38, 0x7e, 0x36, 0x58, 0x4b, 0x7a, 0x01, 0xa3, 0x55,
+	0x55, 0x36, 0x22, 0x24, 0x11, 0x49, 0x26, 0x5c, 0x0b, 0x1a, 0x80, 0xbd, 0xc1, 0x36, 0xb4, 0xd4,
+	0xac, 0x7b, 0xc6, 0x11, 0xb8, 0x1c, 0x6b, 0x51, 0xee, 0x6a, 0xec, 0x32, 0xfb, 0x6c, 0xdb, 0xa0,
+	0xca, 0xf8, 0x5c, 0x8b, 0xf8, 0x1a, 0xce, 0x38, 0x7e, 0x94, 0x7b, 0x3c, 0xfa, 0x42, 0x70, 0x2a,
+	0x35, 0x79, 0x53, 0x4e, 0x97, 0x1f, 0x64, 0xbc, 0x00, 0x7f, 0x99, 0xc9, 0x62, 0xfd, 0x7f, 0x0b,
+	0x0a, 0x27, 0x1b, 0x6c, 0xeb, 0xd0, 0x8a, 0xec, 0x64, 0xc2, 0xd5, 0x3b, 0xfe, 0x22, 0x70, 0x6a,
+	0xa2, 0x66, 0xcb, 0x1d, 0x8c, 0x55, 0x81, 0x3a, 0x24, 0x91, 0x9d, 0x78, 0xf3, 0x4b, 0x26, 0x72,
+	0x36, 0xb0, 0xb0, 0x17, 0xf5, 0xfd, 0x69, 0x27, 0xab, 0x96, 0x1b, 0xf3, 0xf4, 0x1e, 0xbc, 0xde,
+	0xf8, 0x40, 0x4c, 0x8e, 0xc4, 0xbf, 0x94, 0x56, 0x8f, 0xf2, 0xc1, 0x5a, 0x90, 0xf9, 0x37, 0x01,
+	0x48, 0xbb, 0x86, 0x8f, 0xdd, 0x65, 0x69, 0x04, 0x76, 0x8a, 0x92, 0x7a, 0xdd, 0x5e, 0x03, 0x34,
+	0xf5, 0xb5, 0x30, 0x15, 0xaf, 0x60, 0xac, 0x4f, 0x33, 0x34, 0x51, 0x2d, 0x06, 0x37, 0x9b, 0x81,
+	0x9b, 0xa2, 0x7c, 0x6e, 0xb6, 0xf2, 0x9d, 0x06, 0x3d, 0x12, 0x9d, 0x38, 0xff, 0xc3, 0xb6, 0x74,
+	0x5e, 0x47, 0x8c, 0xcd, 0x44, 0x9e, 0x8f, 0xd5, 0xff, 0xbd, 0xfd, 0x19, 0x00, 0x04, 0xf4, 0x70,
+	0xe2, 0xf3, 0x01, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -146,6 +284,8 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type GroupCacheClient interface {
 	Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Remove(ctx context.Context, in *Request, opts ...grpc.CallOption) (*RemoveResponse, error)
+	GetMulti(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
 }
 
 type groupCacheClient struct {
@@ -165,9 +305,29 @@ func (c *groupCacheClient) Get(ctx context.Context, in *Request, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *groupCacheClient) Remove(ctx context.Context, in *Request, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, "/pb.GroupCache/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupCacheClient) GetMulti(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/pb.GroupCache/GetMulti", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GroupCacheServer is the server API for GroupCache service.
 type GroupCacheServer interface {
 	Get(context.Context, *Request) (*Response, error)
+	Remove(context.Context, *Request) (*RemoveResponse, error)
+	GetMulti(context.Context, *BatchRequest) (*BatchResponse, error)
 }
 
 // UnimplementedGroupCacheServer can be embedded to have forward compatible implementations.
@@ -177,6 +337,12 @@ type UnimplementedGroupCacheServer struct {
 func (*UnimplementedGroupCacheServer) Get(ctx context.Context, req *Request) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (*UnimplementedGroupCacheServer) Remove(ctx context.Context, req *Request) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (*UnimplementedGroupCacheServer) GetMulti(ctx context.Context, req *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMulti not implemented")
+}
 
 func RegisterGroupCacheServer(s *grpc.Server, srv GroupCacheServer) {
 	s.RegisterService(&_GroupCache_serviceDesc, srv)
@@ -200,6 +366,42 @@ func _GroupCache_Get_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GroupCache_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GroupCache/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).Remove(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupCache_GetMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupCacheServer).GetMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GroupCache/GetMulti",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupCacheServer).GetMulti(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _GroupCache_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.GroupCache",
 	HandlerType: (*GroupCacheServer)(nil),
@@ -208,6 +410,14 @@ var _GroupCache_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _GroupCache_Get_Handler,
 		},
+		{
+			MethodName: "Remove",
+			Handler:    _GroupCache_Remove_Handler,
+		},
+		{
+			MethodName: "GetMulti",
+			Handler:    _GroupCache_GetMulti_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "geecachepb.proto",
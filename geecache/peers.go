@@ -1,6 +1,9 @@
 package geecache
 
-import "cache/geecache/pb"
+import (
+	"cache/geecache/pb"
+	"context"
+)
 
 //PeerGetter 接口中的Get()方法用于从对应group查找缓存值， PeerGetter 就对应于下面的HTTP客户端
 type PeerGetter interface {
@@ -8,11 +11,57 @@ type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 }
 
+//ContextPeerGetter 由能感知 context 的 PeerGetter 实现，ctx 的截止时间会随请求发送给远程结点
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+//BatchPeerGetter 由支持批量查询的 PeerGetter 实现，用于一次请求获取远程结点上的多个 key
+type BatchPeerGetter interface {
+	GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+}
+
+//PeerRemover 由支持删除操作的 PeerGetter 实现，用于删除远程结点上的缓存
+type PeerRemover interface {
+	Remove(in *pb.Request, out *pb.RemoveResponse) error
+}
+
+//PeerSetter 由支持写入操作的 PeerGetter 实现，用于把加载到的数据推送给副本结点
+type PeerSetter interface {
+	Set(ctx context.Context, in *pb.Request, value *pb.Response) error
+}
+
 //PeerPicker 方法用于根据传入的key选择相应结点peer
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+//ReplicaPicker 由支持副本的 PeerPicker 实现，返回保存 key 的最多 n 个结点，第一个是主结点，其余是副本。
+//结点是自己时对应的元素为 nil
+type ReplicaPicker interface {
+	PickReplicas(key string, n int) []PeerGetter
+}
+
 type PeerHeart interface {
 	HeartBeatingPeer() ([]byte, error)
 }
+
+//localLoadTracker 由需要统计本结点负载的 PeerPicker 实现。Group 在本结点为自己的调用方加载 key 时调用 startLocal，
+//加载结束时调用其返回的函数
+type localLoadTracker interface {
+	startLocal() (done func())
+}
+
+type fromPeerKey struct{}
+
+//withFromPeer 标记请求来自其他结点。这样的请求在本结点加载，不再转发给其他结点：
+//有界负载等策略会把 key 交给不拥有它的结点处理，如果这个结点再根据自己的哈希环转发，请求可能在结点之间来回传递
+func withFromPeer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fromPeerKey{}, true)
+}
+
+//fromPeer 判断请求是否来自其他结点
+func fromPeer(ctx context.Context) bool {
+	v, _ := ctx.Value(fromPeerKey{}).(bool)
+	return v
+}
@@ -0,0 +1,66 @@
+package placement
+
+import (
+	"sync"
+)
+
+// Jump 实现了 Lamping 和 Veach 的 jump 一致性哈希：把 key 映射到 [0, n) 中的一个编号，不需要额外的内存，
+// 查询的时间复杂度为 O(log n)，并且分布非常均匀。
+// 但是编号只能在末尾增加或删除：Add 把结点追加到末尾，此时只有 1/(n+1) 的 key 需要迁移；
+// Remove 删除中间的结点时，后面的结点编号都会改变，迁移量会大很多，适合结点很少下线或者按顺序扩缩容的场景。
+// 结点的编号由 Add 的顺序决定，所有结点必须以相同的顺序加入结点，否则同一个 key 会映射到不同的结点
+type Jump struct {
+	mu    sync.RWMutex
+	nodes []string
+	index map[string]int
+}
+
+func NewJump() *Jump {
+	return &Jump{index: make(map[string]int)}
+}
+
+func (j *Jump) Add(nodes ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := j.index[node]; ok {
+			continue
+		}
+		j.index[node] = len(j.nodes)
+		j.nodes = append(j.nodes, node)
+	}
+}
+
+func (j *Jump) Remove(node string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i, ok := j.index[node]
+	if !ok {
+		return
+	}
+	delete(j.index, node)
+	j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+	for ; i < len(j.nodes); i++ {
+		j.index[j.nodes[i]] = i
+	}
+}
+
+func (j *Jump) Get(key string) string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(hash64(key), len(j.nodes))]
+}
+
+//jumpHash 是论文 "A Fast, Minimal Memory, Consistent Hash Algorithm" 中的算法
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,106 @@
+package placement
+
+import (
+	"cache/geecache/consistenthash"
+	"fmt"
+)
+
+//placement 定义了决定 key 由哪个结点负责的接口。
+//一致性哈希环(consistenthash.Map)、rendezvous 哈希(Rendezvous)和 jump 哈希(Jump)都实现了这个接口，
+//它们在查询速度、结点变化时需要迁移的 key 的数量以及对权重的支持上各有取舍，可以用 cmd/keymove 比较。
+
+// Placement 根据 key 选择结点，实现需要支持并发调用
+type Placement interface {
+	// Add 加入结点，已经存在的结点会被忽略
+	Add(nodes ...string)
+	// Remove 删除结点，结点不存在时什么也不做
+	Remove(node string)
+	// Get 返回 key 所属的结点，没有结点时返回空字符串
+	Get(key string) string
+}
+
+// WeightedPlacement 由支持权重的 Placement 实现，结点分到的 key 与其权重成正比。
+// AddWeights 一次加入多个结点，只重建一次内部的结构
+type WeightedPlacement interface {
+	Placement
+	AddWeighted(node string, weight int)
+	AddWeights(weights map[string]int)
+}
+
+// BoundedPlacement 由支持有界负载的 Placement 实现，参见 consistenthash.Map.GetBounded
+type BoundedPlacement interface {
+	Placement
+	GetBounded(key string, loads map[string]int64, epsilon float64) string
+}
+
+// ReplicatedPlacement 由能为 key 选出多个结点的 Placement 实现，用于把 key 复制到多个结点上。
+// GetN 返回最多 n 个不同的结点，第一个与 Get 的结果相同，结点的变化对其他位置的影响应当尽量小
+type ReplicatedPlacement interface {
+	Placement
+	GetN(key string, n int) []string
+}
+
+// Names 是 New 支持的算法的名字
+var Names = []string{"ring", "rendezvous", "jump"}
+
+// New 根据名字创建 Placement，replicas 是一致性哈希环上每个结点的虚拟结点数，其他算法忽略
+func New(name string, replicas int) (Placement, error) {
+	switch name {
+	case "ring":
+		return consistenthash.New(replicas, nil), nil
+	case "rendezvous":
+		return NewRendezvous(), nil
+	case "jump":
+		return NewJump(), nil
+	}
+	return nil, fmt.Errorf("unknown placement %q", name)
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+//fnv64a 在 FNV-1a 的中间状态 h 上继续计算 s，不需要分配内存
+func fnv64a(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+//hash64 计算 key 的 64 位哈希值
+func hash64(key string) uint64 {
+	return mix(fnv64a(fnvOffset64, key))
+}
+
+//mix 是 splitmix64 的混淆函数，使 FNV 结果的各个比特分布更均匀
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Movement 统计在 nodes 组成的 p 上执行 change 之后，keys 中所属结点发生变化的比例
+func Movement(p Placement, nodes []string, keys []string, change func(p Placement)) float64 {
+	if len(keys) == 0 {
+		return 0
+	}
+	p.Add(nodes...)
+	before := make([]string, len(keys))
+	for i, key := range keys {
+		before[i] = p.Get(key)
+	}
+	change(p)
+	moved := 0
+	for i, key := range keys {
+		if p.Get(key) != before[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(keys))
+}
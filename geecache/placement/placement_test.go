@@ -0,0 +1,181 @@
+package placement
+
+import (
+	"cache/geecache/consistenthash"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+type algorithm struct {
+	name string
+	new  func() Placement
+}
+
+var algorithms []algorithm
+
+func init() {
+	for _, name := range Names {
+		name := name
+		algorithms = append(algorithms, algorithm{name, func() Placement {
+			p, _ := New(name, 100)
+			return p
+		}})
+	}
+}
+
+var (
+	_ WeightedPlacement   = (*consistenthash.Map)(nil)
+	_ BoundedPlacement    = (*consistenthash.Map)(nil)
+	_ ReplicatedPlacement = (*consistenthash.Map)(nil)
+	_ WeightedPlacement   = (*Rendezvous)(nil)
+	_ ReplicatedPlacement = (*Rendezvous)(nil)
+	_ Placement           = (*Jump)(nil)
+)
+
+func testNodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i+1)
+	}
+	return nodes
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("maglev", 0); err == nil {
+		t.Fatal("expected an error for an unknown placement")
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	nodes, keys := testNodes(4), testKeys(40000)
+	for _, a := range algorithms {
+		p := a.new()
+		if p.Get("key") != "" {
+			t.Errorf("%s: empty placement should yield nothing", a.name)
+		}
+		p.Add(nodes...)
+		counts := make(map[string]int)
+		for _, key := range keys {
+			counts[p.Get(key)]++
+		}
+		want := float64(len(keys)) / float64(len(nodes))
+		for _, node := range nodes {
+			if got := float64(counts[node]); got < want*0.85 || got > want*1.15 {
+				t.Errorf("%s: %s got %v keys, want about %v", a.name, node, got, want)
+			}
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	nodes, keys := testNodes(10), testKeys(20000)
+	for _, a := range algorithms {
+		//增加一个结点时，理想情况下只有 1/11 的 key 迁移到新结点
+		moved := Movement(a.new(), nodes, keys, func(p Placement) { p.Add("http://10.0.0.100:8001") })
+		if moved > 1.0/11*1.3 {
+			t.Errorf("%s: adding a node moved %.3f of keys", a.name, moved)
+		}
+		//删除最后一个结点时，只有属于它的 1/10 的 key 需要迁移
+		moved = Movement(a.new(), nodes, keys, func(p Placement) { p.Remove(nodes[len(nodes)-1]) })
+		if moved > 1.0/10*1.3 {
+			t.Errorf("%s: removing the last node moved %.3f of keys", a.name, moved)
+		}
+	}
+
+	//删除中间的结点时 jump 哈希需要迁移更多的 key，其他算法不受影响
+	for _, a := range algorithms {
+		moved := Movement(a.new(), nodes, keys, func(p Placement) { p.Remove(nodes[0]) })
+		if a.name == "jump" {
+			if moved < 0.5 {
+				t.Errorf("jump: removing the first node should move most keys, moved %.3f", moved)
+			}
+		} else if moved > 1.0/10*1.3 {
+			t.Errorf("%s: removing the first node moved %.3f of keys", a.name, moved)
+		}
+	}
+}
+
+func TestRendezvousWeighted(t *testing.T) {
+	r := NewRendezvous()
+	weights := map[string]int{"a": 1, "b": 2, "c": 3}
+	for node, w := range weights {
+		r.AddWeighted(node, w)
+	}
+	const n = 60000
+	counts := make(map[string]int)
+	for _, key := range testKeys(n) {
+		counts[r.Get(key)]++
+	}
+	for node, w := range weights {
+		want := float64(n) * float64(w) / 6
+		if got := float64(counts[node]); got < want*0.9 || got > want*1.1 {
+			t.Errorf("%s with weight %d got %v keys, want about %v", node, w, got, want)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	nodes, keys := testNodes(5), testKeys(1000)
+	for _, p := range []ReplicatedPlacement{consistenthash.New(100, nil), NewRendezvous()} {
+		p.Add(nodes...)
+		for _, key := range keys {
+			replicas := p.GetN(key, 3)
+			if len(replicas) != 3 || replicas[0] != p.Get(key) {
+				t.Fatalf("%T: replicas of %s are %v, owner is %s", p, key, replicas, p.Get(key))
+			}
+			if replicas[0] == replicas[1] || replicas[1] == replicas[2] || replicas[0] == replicas[2] {
+				t.Fatalf("%T: replicas of %s are not distinct: %v", p, key, replicas)
+			}
+		}
+		//删除主结点之后，原来的第二个结点成为新的主结点
+		for _, key := range keys[:100] {
+			replicas := p.GetN(key, 2)
+			p.Remove(replicas[0])
+			if got := p.Get(key); got != replicas[1] {
+				t.Fatalf("%T: after removing %s, %s should move to %s, got %s", p, replicas[0], key, replicas[1], got)
+			}
+			p.Add(replicas[0])
+		}
+		if got := p.GetN("key", 10); len(got) != len(nodes) {
+			t.Fatalf("%T: expected all %d nodes, got %v", p, len(nodes), got)
+		}
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	//同一个 key 在桶的数量增加时只会跳到新的桶中
+	for key := uint64(0); key < 1000; key++ {
+		prev := jumpHash(key, 1)
+		for n := 2; n <= 20; n++ {
+			b := jumpHash(key, n)
+			if b != prev && b != n-1 {
+				t.Fatalf("key %d moved from %d to %d with %d buckets", key, prev, b, n)
+			}
+			prev = b
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, a := range algorithms {
+		for _, n := range []int{10, 100} {
+			p := a.new()
+			p.Add(testNodes(n)...)
+			keys := testKeys(1024)
+			b.Run(fmt.Sprintf("%s/%d", a.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
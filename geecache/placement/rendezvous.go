@@ -0,0 +1,121 @@
+package placement
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Rendezvous 实现了 rendezvous 哈希(也叫最高随机权重哈希，HRW)：
+// 对每个结点计算 hash(结点, key)，得分最高的结点拥有 key。
+// 增加或删除一个结点时只有属于该结点的 key 需要迁移，并且不需要虚拟结点就能分布均匀，
+// 代价是每次查询需要遍历所有结点，时间复杂度为 O(n)
+type Rendezvous struct {
+	mu      sync.RWMutex
+	nodes   []string //按名字排序，保证得分相同时结果一致
+	weights map[string]int
+	seeds   map[string]uint64 //每个结点名字的 FNV 中间状态，查询时只需要继续计算 key
+}
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{weights: make(map[string]int), seeds: make(map[string]uint64)}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := r.weights[node]; !ok {
+			r.weights[node] = 1
+		}
+	}
+	r.sortNodes()
+}
+
+// AddWeighted 加入权重为 weight 的结点，结点已经存在时更新其权重，weight 小于 1 时视为 1
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	r.weights[node] = weight
+	r.sortNodes()
+}
+
+// AddWeights 与 AddWeighted 相同，但一次加入多个结点
+func (r *Rendezvous) AddWeights(weights map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for node, weight := range weights {
+		if weight < 1 {
+			weight = 1
+		}
+		r.weights[node] = weight
+	}
+	r.sortNodes()
+}
+
+func (r *Rendezvous) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.weights[node]; !ok {
+		return
+	}
+	delete(r.weights, node)
+	delete(r.seeds, node)
+	r.sortNodes()
+}
+
+//sortNodes 根据 weights 重建 nodes，调用时需持有 r.mu
+func (r *Rendezvous) sortNodes() {
+	r.nodes = r.nodes[:0]
+	for node := range r.weights {
+		r.nodes = append(r.nodes, node)
+		r.seeds[node] = fnv64a(fnvOffset64, node+"/")
+	}
+	sort.Strings(r.nodes)
+}
+
+func (r *Rendezvous) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	best, bestScore := "", math.Inf(-1)
+	for _, node := range r.nodes {
+		if score := r.score(node, key); score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// GetN 返回得分最高的 n 个结点，按得分从高到低排列
+func (r *Rendezvous) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	scores := make(map[string]float64, len(r.nodes))
+	nodes := make([]string, len(r.nodes))
+	for i, node := range r.nodes {
+		scores[node] = r.score(node, key)
+		nodes[i] = node
+	}
+	//nodes 已经按名字排序，稳定排序保证得分相同时与 Get 的结果一致
+	sort.SliceStable(nodes, func(i, j int) bool { return scores[nodes[i]] > scores[nodes[j]] })
+	return nodes[:n]
+}
+
+//score 计算结点的得分 weight / -ln(u)，u 是把哈希值映射到 (0,1) 之后的结果，
+//这样结点被选中的概率与其权重成正比，权重都相同时等价于直接比较哈希值
+func (r *Rendezvous) score(node, key string) float64 {
+	h := mix(fnv64a(r.seeds[node], key))
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return float64(r.weights[node]) / -math.Log(u)
+}
@@ -5,7 +5,6 @@ package sentinel
 import (
 	"fmt"
 	"net"
-	"os"
 	"time"
 )
 
@@ -31,7 +30,13 @@ func NewPingOption(count int, size int, timeout int64) *PingOption {
 // Ping 的基本原理是发送和接受ICMP请求回显报文。接收方将报文原封不动的返回发送方，发送方校验报文，校验成功则表示ping通。
 // 一台主机向一个节点发送一个类型字段值为8的ICMP报文，如果途中没有异常（如果没有被路由丢弃，目标不回应ICMP或者传输失败），
 // 则目标返回类型字段值为0的ICMP报文，说明这台主机可达
+// 注意发送ICMP报文需要原始套接字权限，没有权限或者解析地址失败时直接返回 false
 func Ping(host string, options *PingOption) bool {
+	return ping(host, options) == nil
+}
+
+//ping 与 Ping 相同，但返回失败的原因，成功率低于 successRate 时同样返回错误
+func ping(host string, options *PingOption) error {
 	var count int
 	var size int
 	var timeout int64
@@ -48,17 +53,17 @@ func Ping(host string, options *PingOption) bool {
 		size = options.Size
 		timeout = options.Timeout
 	}
+	if count <= 0 {
+		return fmt.Errorf("ping %s: count must be positive", host)
+	}
 
-	//本地地址localhost我们取127.0.0.1
-	IPs, _ := net.LookupIP(host)
-	host = IPs[1].String()
-
-	starttime := time.Now()
-	//此处的链接conn只是为了获得ip := conn.RemoteAddr(),显示出来，因为后面每次连接都会重新获取conn,todo 但是每次重新获取的conn,其连接的ip保证一致么？
-	conn, err := net.DialTimeout("ip4:icmp", host, time.Duration(timeout))
-	//每个域名可能对应多个ip，但实际连接时，请求只会转发到某一个上，故需要获取实际连接的远程ip，才能知道实际ping的机器是哪台
-	//  ip := conn.RemoteAddr()
-	//fmt.Println("正在 Ping" + " [" + host + "] 具有 32 字节的数据:")
+	//一个域名可能解析出多个ip，例如localhost会得到::1和127.0.0.1，这里取第一个IPv4地址
+	ip, err := lookupIPv4(host)
+	if err != nil {
+		return err
+	}
+	host = ip.String()
+	wait := time.Duration(timeout) * time.Millisecond
 
 	var seq int16 = 1
 	id0, id1 := genidentifier3(host)
@@ -72,12 +77,6 @@ func Ping(host string, options *PingOption) bool {
 	recvN := 0
 	//记录失败请求数
 	lostN := 0
-	//所有请求中应答时间最短的一个
-	shortT := -1
-	//所有请求中应答时间最长的一个
-	longT := -1
-	//所有请求的应答时间和
-	sumT := 0
 
 	for count > 0 {
 		sendN++
@@ -102,65 +101,67 @@ func Ping(host string, options *PingOption) bool {
 		msg[2] = byte(check >> 8)
 		msg[3] = byte(check & 255)
 
-		conn, err = net.DialTimeout("ip:icmp", host, time.Duration(timeout*1000*1000))
-		//todo test
-		//ip := conn.RemoteAddr()
-
-		checkError3(err)
-
-		starttime = time.Now()
-		//conn.SetReadDeadline可以在未收到数据的指定时间内停止Read等待，并返回错误err，然后判定请求超时
-		conn.SetDeadline(starttime.Add(time.Duration(timeout * 1000 * 1000)))
-		//onn.Write方法执行之后也就发送了一条ICMP请求，同时进行计时和计次
-		_, err = conn.Write(msg[0:length])
-
-		// 在使用Go语言的net.Dial函数时，发送echo request报文时，不用考虑i前20个字节的ip头；
-		// 但是在接收到echo response消息时，前20字节是ip头。后面的内容才是icmp的内容，应该与echo request的内容一致
-		const ECHO_REPLY_HEAD_LEN = 20
+		if ok, err := echo(host, msg[0:length], wait); err != nil {
+			//没有权限等错误，继续发送也不会成功
+			return fmt.Errorf("ping %s: %v", host, err)
+		} else if ok {
+			recvN++
+		} else {
+			lostN++
+		}
 
-		var receive = make([]byte, ECHO_REPLY_HEAD_LEN+length)
-		_, err := conn.Read(receive)
+		seq++
+		count--
+	}
 
-		var endduration int = int(int64(time.Since(starttime)) / (1000 * 1000))
+	if float64(recvN) / float64(sendN) < successRate {
+		return fmt.Errorf("ping %s: %d of %d packets lost", host, lostN, sendN)
+	}
+	return nil
+}
 
-		sumT += endduration
+//echo 发送一个回显请求报文，返回是否在 wait 内收到了匹配的应答，只有连接失败时才返回错误
+func echo(host string, msg []byte, wait time.Duration) (bool, error) {
+	conn, err := net.DialTimeout("ip4:icmp", host, wait)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
 
-		//time.Sleep(1000 * 1000)
+	starttime := time.Now()
+	//conn.SetReadDeadline可以在未收到数据的指定时间内停止Read等待，并返回错误err，然后判定请求超时
+	conn.SetDeadline(starttime.Add(wait))
+	//onn.Write方法执行之后也就发送了一条ICMP请求，同时进行计时和计次
+	if _, err = conn.Write(msg); err != nil {
+		return false, nil
+	}
 
-		//除了判断err!=nil，还有判断请求和应答的ID标识符，sequence序列码是否一致，以及ICMP是否超时（receive[ECHO_REPLY_HEAD_LEN] == 11，即ICMP报头的类型为11时表示ICMP超时）
-		if err != nil || receive[ECHO_REPLY_HEAD_LEN+4] != msg[4] || receive[ECHO_REPLY_HEAD_LEN+5] != msg[5] || receive[ECHO_REPLY_HEAD_LEN+6] != msg[6] || receive[ECHO_REPLY_HEAD_LEN+7] != msg[7] || endduration >= int(timeout) || receive[ECHO_REPLY_HEAD_LEN] == 11 {
-			lostN++
-			//todo
-			//fmt.Println("对 " + cname + "[" + ip.String() + "]" + " 的请求超时。")
+	// 在使用Go语言的net.Dial函数时，发送echo request报文时，不用考虑i前20个字节的ip头；
+	// 但是在接收到echo response消息时，前20字节是ip头。后面的内容才是icmp的内容，应该与echo request的内容一致
+	const ECHO_REPLY_HEAD_LEN = 20
 
-		} else {
-			if shortT == -1 {
-				shortT = endduration
-			} else if shortT > endduration {
-				shortT = endduration
-			}
-			if longT == -1 {
-				longT = endduration
-			} else if longT < endduration {
-				longT = endduration
-			}
-			recvN++
-			//ttl := int(receive[8])
-			//todo
-			//fmt.Println("来自 " + "[" + host + "]" + " 的回复: 字节=32 时间=" + strconv.Itoa(endduration) + "ms TTL=" + strconv.Itoa(ttl))
-		}
+	var receive = make([]byte, ECHO_REPLY_HEAD_LEN+len(msg))
+	n, err := conn.Read(receive)
 
-		seq++
-		count--
+	//除了判断err!=nil，还有判断请求和应答的ID标识符，sequence序列码是否一致，以及ICMP是否超时（receive[ECHO_REPLY_HEAD_LEN] == 11，即ICMP报头的类型为11时表示ICMP超时）
+	if err != nil || n < ECHO_REPLY_HEAD_LEN+8 || receive[ECHO_REPLY_HEAD_LEN+4] != msg[4] || receive[ECHO_REPLY_HEAD_LEN+5] != msg[5] || receive[ECHO_REPLY_HEAD_LEN+6] != msg[6] || receive[ECHO_REPLY_HEAD_LEN+7] != msg[7] || time.Since(starttime) >= wait || receive[ECHO_REPLY_HEAD_LEN] == 11 {
+		return false, nil
 	}
-	//todo 先注释，用下一行测试
-	//stat3(ip.String(), sendN, lostN, recvN, shortT, longT, sumT)
+	return true, nil
+}
 
-	if float64(recvN) / float64(sendN) < successRate{
-		return false
+//lookupIPv4 解析 host，返回其中第一个IPv4地址
+func lookupIPv4(host string) (net.IP, error) {
+	IPs, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
 	}
-
-	return true
+	for _, ip := range IPs {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+	return nil, fmt.Errorf("no IPv4 address found for %s", host)
 }
 
 func checkSum3(msg []byte) uint16 {
@@ -180,13 +181,6 @@ func checkSum3(msg []byte) uint16 {
 	return answer
 }
 
-func checkError3(err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Fatal error: %s", err.Error())
-		os.Exit(1)
-	}
-}
-
 func gensequence3(v int16) (byte, byte) {
 	ret1 := byte(v >> 8)
 	ret2 := byte(v & 255)
@@ -196,13 +190,3 @@ func gensequence3(v int16) (byte, byte) {
 func genidentifier3(host string) (byte, byte) {
 	return host[0], host[1]
 }
-
-//func stat3(ip string, sendN int, lostN int, recvN int, shortT int, longT int, sumT int) {
-//	fmt.Println()
-//	fmt.Println(ip, " 的 Ping 统计信息:")
-//	fmt.Printf("    数据包: 已发送 = %d，已接收 = %d，丢失 = %d (%d%% 丢失)，\n", sendN, recvN, lostN, int(lostN*100/sendN))
-//	fmt.Println("往返行程的估计时间(以毫秒为单位):")
-//	if recvN != 0 {
-//		fmt.Printf("    最短 = %dms，最长 = %dms，平均 = %dms\n", shortT, longT, sumT/sendN)
-//	}
-//}
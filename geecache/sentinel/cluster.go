@@ -0,0 +1,237 @@
+package sentinel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//多哨兵模式参考了 Redis Sentinel：每个哨兵独立探测结点，探测失败只代表主观下线(subjective down)，
+//哨兵之间互相交换主观下线报告，只有当至少 quorum 个哨兵都认为结点下线时，结点才被判定为客观下线(objective down)，
+//此时才会通知缓存结点将其从哈希环中删除。这样可以避免单个哨兵与结点之间的网络问题造成误判。
+
+//defaultSentinelPath 是哨兵之间通信的路径前缀，例如 /sentinel/report
+var defaultSentinelPath = "/sentinel/"
+
+//report 是某个哨兵对某个结点的主观判断
+type report struct {
+	Sentinel string    `json:"sentinel"`
+	Peer     string    `json:"peer"`
+	Down     bool      `json:"down"`
+	Time     time.Time `json:"-"` //收到报告的时间，用于判断报告是否过期
+}
+
+//transport 负责哨兵之间的 RPC 以及向缓存结点推送消息，测试时可以替换为内存实现
+type transport interface {
+	//call 调用 addr 上哨兵的 method 方法，args 和 reply 会被编码为 JSON
+	call(addr, method string, args, reply interface{}) error
+	//notify 把 msg 推送给缓存结点 peer
+	notify(peer string, msg failMsg) ([]byte, error)
+}
+
+// SetCluster 开启多哨兵模式，sentinels 为其他哨兵的地址，quorum 为判定结点客观下线所需的哨兵数(包括自己)，
+// 哨兵之间通过 Raft 选出负责广播的 leader。需要在 HeartBeating 之前调用，同时需要将 HTTPSentinel 作为 http.Handler 对外提供服务
+func (S *HTTPSentinel) SetCluster(sentinels []string, quorum int) {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	S.sentinels = nil
+	for _, s := range sentinels {
+		if s != S.self {
+			S.sentinels = append(S.sentinels, s)
+		}
+	}
+	if quorum < 1 {
+		quorum = 1
+	}
+	S.quorum = quorum
+
+	S.raft = newRaft(S.self, S.sentinels, func(addr, method string, args, reply interface{}) error {
+		return S.transport.call(addr, method, args, reply)
+	})
+	S.raft.onLeader = S.announcePeers
+	S.raft.epoch = S.currentEpoch
+	S.raft.observe = S.observeEpoch
+	S.raft.logf = S.Log
+	S.elector = S.raft
+}
+
+//reportTTL 是其他哨兵报告的有效期，主观下线的哨兵每一轮探测都会重新发送报告
+func (S *HTTPSentinel) reportTTL() time.Duration {
+	return 3 * S.requestInterval
+}
+
+//setSubjective 记录自己对 peer 的主观判断，并通知其他哨兵，然后重新判断 peer 是否客观下线
+func (S *HTTPSentinel) setSubjective(peer string, down bool) {
+	S.mu.Lock()
+	prev := S.reports[peer][S.self]
+	S.record(report{Sentinel: S.self, Peer: peer, Down: down})
+	sentinels := S.sentinels
+	S.mu.Unlock()
+
+	//主观下线期间每一轮都重新发送报告，避免其在其他哨兵处过期；恢复时只需要发送一次
+	if down || prev.Down {
+		r := report{Sentinel: S.self, Peer: peer, Down: down}
+		for _, s := range sentinels {
+			if err := S.transport.call(s, "report", r, nil); err != nil {
+				S.Log("send report to sentinel %s failed: %v", s, err)
+			}
+		}
+	}
+	S.evaluate(peer)
+}
+
+//record 保存一份报告，调用时需持有 S.mu
+func (S *HTTPSentinel) record(r report) {
+	if S.reports[r.Peer] == nil {
+		S.reports[r.Peer] = make(map[string]report)
+	}
+	r.Time = time.Now()
+	S.reports[r.Peer][r.Sentinel] = r
+}
+
+//handleReport 处理其他哨兵发来的报告
+func (S *HTTPSentinel) handleReport(r report) {
+	S.mu.Lock()
+	if _, ok := S.peers[r.Peer]; !ok {
+		S.mu.Unlock()
+		return
+	}
+	S.record(r)
+	S.mu.Unlock()
+	S.evaluate(r.Peer)
+}
+
+//evaluate 统计认为 peer 主观下线的哨兵数，达到 quorum 时判定其客观下线；
+//低于 quorum 并且自己也探测到 peer 存活时判定其重新上线
+func (S *HTTPSentinel) evaluate(peer string) {
+	S.mu.Lock()
+	n := 0
+	for sentinel, r := range S.reports[peer] {
+		if r.Down && (sentinel == S.self || time.Since(r.Time) < S.reportTTL()) {
+			n++
+		}
+	}
+	own := S.reports[peer][S.self]
+
+	var msgs []failMsg
+	if n >= S.quorum && !S.failed[peer] {
+		S.failed[peer] = true
+		msgs = append(msgs, S.newMsg(peer, eventDown))
+		S.Log("%s is objectively down, %d sentinels agree", peer, n)
+	} else if n < S.quorum && S.failed[peer] && !own.Down && !own.Time.IsZero() {
+		delete(S.failed, peer)
+		msgs = append(msgs, S.newMsg(peer, eventUp))
+		S.Log("%s recovered", peer)
+	}
+	S.mu.Unlock()
+
+	for _, msg := range msgs {
+		S.ch <- msg
+	}
+}
+
+// ServeHTTP 处理其他哨兵发来的请求，路径为 /sentinel/<method>，请求体和响应体都是 JSON
+func (S *HTTPSentinel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, defaultSentinelPath) || r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := S.dispatch(r.URL.Path[len(defaultSentinelPath):], body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+//dispatch 根据 method 处理一次哨兵之间的调用，返回编码后的响应
+func (S *HTTPSentinel) dispatch(method string, body []byte) ([]byte, error) {
+	switch method {
+	case "report":
+		r := report{}
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		S.handleReport(r)
+		return json.Marshal(struct{}{})
+	case "vote", "heartbeat":
+		if S.raft == nil {
+			return nil, fmt.Errorf("sentinel %s is not in cluster mode", S.self)
+		}
+		if method == "vote" {
+			args := voteArgs{}
+			if err := json.Unmarshal(body, &args); err != nil {
+				return nil, err
+			}
+			return json.Marshal(S.raft.handleVote(args))
+		}
+		args := heartbeatArgs{}
+		if err := json.Unmarshal(body, &args); err != nil {
+			return nil, err
+		}
+		return json.Marshal(S.raft.handleHeartbeat(args))
+	}
+	return nil, fmt.Errorf("unknown method: %s", method)
+}
+
+//httpTransport 是默认的 transport，通过 HTTP 传递 JSON 消息
+type httpTransport struct {
+	client *http.Client
+}
+
+func newHTTPTransport() *httpTransport {
+	return &httpTransport{client: &http.Client{Timeout: defaultProbeTimeout}}
+}
+
+func (t *httpTransport) call(addr, method string, args, reply interface{}) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Post(addr+defaultSentinelPath+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("sentinel returned: %v %s", res.Status, body)
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.Unmarshal(body, reply)
+}
+
+func (t *httpTransport) notify(peer string, msg failMsg) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPut, peer+defaultPUTPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return ioutil.ReadAll(res.Body)
+}
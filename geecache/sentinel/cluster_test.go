@@ -0,0 +1,185 @@
+package sentinel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+//memNetwork 是在内存中传递消息的 transport，调用是同步的，便于编写确定性的测试
+type memNetwork struct {
+	mu        sync.Mutex
+	sentinels map[string]*HTTPSentinel
+	cut       map[string]bool //被隔离的哨兵，发往或来自它们的调用都会失败
+	notified  []failMsg       //哨兵推送给缓存结点的消息
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{sentinels: make(map[string]*HTTPSentinel), cut: make(map[string]bool)}
+}
+
+//memTransport 是某个哨兵在 memNetwork 中的端点
+type memTransport struct {
+	net  *memNetwork
+	from string
+}
+
+func (t *memTransport) call(addr, method string, args, reply interface{}) error {
+	t.net.mu.Lock()
+	s, ok := t.net.sentinels[addr]
+	cut := t.net.cut[addr] || t.net.cut[t.from]
+	t.net.mu.Unlock()
+	if !ok || cut {
+		return fmt.Errorf("sentinel %s unreachable", addr)
+	}
+
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	res, err := s.dispatch(method, body)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.Unmarshal(res, reply)
+}
+
+func (t *memTransport) notify(peer string, msg failMsg) ([]byte, error) {
+	t.net.mu.Lock()
+	defer t.net.mu.Unlock()
+	t.net.notified = append(t.net.notified, msg)
+	return nil, nil
+}
+
+//startTestSentinels 在 network 中启动 n 个监视 peers 的哨兵，每个哨兵使用各自的 fakeProber
+func startTestSentinels(network *memNetwork, n, quorum int, peers []string) ([]*HTTPSentinel, []*fakeProber) {
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("sentinel-%d", i))
+	}
+	var sentinels []*HTTPSentinel
+	var probers []*fakeProber
+	for _, name := range names {
+		s := NewSentinel(name, peers, 0, 0)
+		p := &fakeProber{}
+		s.SetProber(p)
+		s.SetCluster(names, quorum)
+		s.transport = &memTransport{net: network, from: name}
+		network.sentinels[name] = s
+		sentinels = append(sentinels, s)
+		probers = append(probers, p)
+	}
+	return sentinels, probers
+}
+
+//pending 取出哨兵待广播的全部消息
+func pending(s *HTTPSentinel) []failMsg {
+	var msgs []failMsg
+	for {
+		select {
+		case msg := <-s.ch:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, probers := startTestSentinels(network, 3, 2, peers)
+	peer := peers[0]
+
+	//只有一个哨兵探测失败，可能只是它与结点之间的网络有问题，不能判定结点下线
+	probers[0].set(peer, true)
+	for _, s := range sentinels {
+		s.check(peer)
+	}
+	for _, s := range sentinels {
+		if msgs := pending(s); len(msgs) != 0 {
+			t.Fatalf("%s should not report %s with one vote, got %v", s.self, peer, msgs)
+		}
+	}
+
+	//第二个哨兵也探测失败，达到 quorum，所有哨兵都判定结点客观下线
+	probers[1].set(peer, true)
+	sentinels[1].check(peer)
+	for _, s := range sentinels {
+		msgs := pending(s)
+		if len(msgs) != 1 || msgs[0].PeerName != peer || msgs[0].Event != eventDown {
+			t.Fatalf("%s should report %s down once, got %v", s.self, peer, msgs)
+		}
+	}
+
+	//再次探测不会重复通知
+	for _, s := range sentinels {
+		s.check(peer)
+		if msgs := pending(s); len(msgs) != 0 {
+			t.Fatalf("%s should not report %s twice, got %v", s.self, peer, msgs)
+		}
+	}
+
+	//结点恢复后，探测成功的哨兵撤回报告并通知结点上线
+	probers[0].set(peer, false)
+	probers[1].set(peer, false)
+	sentinels[0].check(peer)
+	msgs := pending(sentinels[0])
+	if len(msgs) != 1 || msgs[0].Event != eventUp {
+		t.Fatalf("sentinel-0 should report %s up, got %v", peer, msgs)
+	}
+}
+
+func TestQuorumPartition(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, probers := startTestSentinels(network, 3, 2, peers)
+	peer := peers[0]
+
+	//被隔离的哨兵无法与其他哨兵交换报告，即使探测失败也无法达到 quorum
+	network.cut[sentinels[2].self] = true
+	probers[2].set(peer, true)
+	sentinels[2].check(peer)
+	for _, s := range sentinels {
+		if msgs := pending(s); len(msgs) != 0 {
+			t.Fatalf("%s should not report %s, got %v", s.self, peer, msgs)
+		}
+	}
+
+	//单哨兵模式下一次探测失败就会判定结点下线
+	single := NewSentinel("single", peers, 0, 0)
+	p := &fakeProber{}
+	p.set(peer, true)
+	single.SetProber(p)
+	single.check(peer)
+	if msgs := pending(single); len(msgs) != 1 || msgs[0].Event != eventDown {
+		t.Fatalf("single sentinel should report %s down, got %v", peer, msgs)
+	}
+}
+
+func TestEpoch(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, _ := startTestSentinels(network, 2, 1, peers)
+
+	sentinels[0].mu.Lock()
+	first := sentinels[0].newMsg(peers[0], eventDown)
+	second := sentinels[0].newMsg(peers[0], eventUp)
+	sentinels[0].mu.Unlock()
+	if second.Epoch <= first.Epoch {
+		t.Fatalf("epoch should increase, got %d then %d", first.Epoch, second.Epoch)
+	}
+
+	//follower 通过心跳得知 leader 的 epoch，自己成为 leader 后发出的消息 epoch 更大
+	future := second.Epoch + uint64(time.Hour)
+	sentinels[0].observeEpoch(future)
+	sentinels[1].raft.handleHeartbeat(heartbeatArgs{Term: 1, Leader: sentinels[0].self, Epoch: sentinels[0].currentEpoch()})
+	sentinels[1].mu.Lock()
+	msg := sentinels[1].newMsg(peers[0], eventDown)
+	sentinels[1].mu.Unlock()
+	if msg.Epoch <= future {
+		t.Fatalf("new leader's epoch %d should be larger than %d", msg.Epoch, future)
+	}
+}
@@ -0,0 +1,122 @@
+package sentinel
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var defaultProbeTimeout = time.Second
+
+// Prober 用于探测结点是否存活，peer 是结点的地址，例如 http://localhost:8001，返回 nil 表示结点存活
+type Prober interface {
+	Probe(peer string) error
+}
+
+// ProberFunc 把普通函数转换为 Prober
+type ProberFunc func(peer string) error
+
+func (f ProberFunc) Probe(peer string) error {
+	return f(peer)
+}
+
+// NewProber 根据名称创建 Prober，可选 tcp、http 和 icmp
+func NewProber(kind string) (Prober, error) {
+	switch kind {
+	case "tcp", "":
+		return &TCPProber{}, nil
+	case "http":
+		return &HTTPProber{}, nil
+	case "icmp":
+		return &ICMPProber{}, nil
+	}
+	return nil, fmt.Errorf("unknown prober: %s", kind)
+}
+
+// TCPProber 通过建立 TCP 连接探测结点，不需要任何特殊权限，是默认的 Prober
+type TCPProber struct {
+	Timeout time.Duration
+}
+
+func (p *TCPProber) Probe(peer string) error {
+	addr, err := peerHost(peer, true)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeoutOr(p.Timeout))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProber 向结点发送 GET 请求，只要结点返回了状态码小于 500 的响应就认为其存活
+type HTTPProber struct {
+	Timeout time.Duration
+	Path    string //请求的路径，默认为 /
+}
+
+func (p *HTTPProber) Probe(peer string) error {
+	client := http.Client{Timeout: timeoutOr(p.Timeout)}
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+	res, err := client.Get(peer + path)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// ICMPProber 使用 Ping 探测结点所在的主机，需要原始套接字权限，通常要以 root 运行
+type ICMPProber struct {
+	Option *PingOption //为 nil 时使用默认的次数、大小和超时时间
+}
+
+func (p *ICMPProber) Probe(peer string) error {
+	host, err := peerHost(peer, false)
+	if err != nil {
+		return err
+	}
+	option := p.Option
+	if option == nil {
+		option = NewPingOption(defaultPingCount, defaultPingSize, int64(defaultPingTime))
+	}
+	return ping(host, option)
+}
+
+//peerHost 从 http://localhost:8001 形式的地址中取出 localhost:8001，withPort 为 false 时只取出 localhost
+func peerHost(peer string, withPort bool) (string, error) {
+	u, err := url.Parse(peer)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid peer address: %s", peer)
+	}
+	if withPort {
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "80"), nil
+		}
+		return u.Host, nil
+	}
+	return u.Hostname(), nil
+}
+
+func timeoutOr(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultProbeTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,336 @@
+package sentinel
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//多哨兵模式下每个哨兵都会判定结点客观下线，为了避免重复通知缓存结点，哨兵之间通过 Raft 的选主算法选出一个 leader，
+//只有 leader 负责广播 failMsg。这里只实现了 Raft 的选主部分(RequestVote 和心跳)，没有日志复制，
+//所以投票时不需要比较日志，任期内先到先得。
+
+// Elector 决定当前哨兵是否负责向缓存结点广播消息
+type Elector interface {
+	IsLeader() bool
+}
+
+// SetElector 替换选主的方式，需要在 SetCluster 之后、HeartBeating 之前调用
+func (S *HTTPSentinel) SetElector(e Elector) {
+	S.elector = e
+}
+
+//alwaysLeader 用于单哨兵模式，唯一的哨兵总是 leader
+type alwaysLeader struct{}
+
+func (alwaysLeader) IsLeader() bool {
+	return true
+}
+
+var (
+	defaultTickInterval   = 100 * time.Millisecond
+	defaultElectionTicks  = 10 //选举超时为 defaultElectionTicks 到 2*defaultElectionTicks 个 tick
+	defaultHeartbeatTicks = 3  //leader 每隔 defaultHeartbeatTicks 个 tick 发送一次心跳
+)
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	switch r {
+	case follower:
+		return "follower"
+	case candidate:
+		return "candidate"
+	}
+	return "leader"
+}
+
+type voteArgs struct {
+	Term      uint64 `json:"term"`
+	Candidate string `json:"candidate"`
+}
+
+type voteReply struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type heartbeatArgs struct {
+	Term   uint64 `json:"term"`
+	Leader string `json:"leader"`
+	Epoch  uint64 `json:"epoch"` //leader 发出的最近一条消息的 epoch
+}
+
+type heartbeatReply struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+}
+
+//raft 实现了 Raft 的选主，由 tick 驱动，测试时可以手动调用 tick 得到确定的结果
+type raft struct {
+	mu       sync.Mutex
+	self     string
+	peers    []string //其他哨兵
+	role     role
+	term     uint64
+	votedFor string
+	leader   string
+	elapsed  int //距离上一次收到心跳(或者发送心跳)经过的 tick 数
+	timeout  int //选举超时的 tick 数
+	//leader 距离上一次得到多数哨兵响应经过的 tick 数，超过选举超时后 leader 退位(check quorum)，
+	//避免被隔离在少数派中的旧 leader 与新 leader 同时广播
+	sinceQuorum int
+
+	call        func(addr, method string, args, reply interface{}) error
+	randTimeout func() int
+	onLeader    func()             //成为 leader 时调用
+	epoch       func() uint64      //leader 在心跳中附带的消息 epoch
+	observe     func(epoch uint64) //follower 收到心跳时记录 leader 的消息 epoch
+	logf        func(format string, v ...interface{})
+}
+
+func newRaft(self string, peers []string, call func(addr, method string, args, reply interface{}) error) *raft {
+	r := &raft{
+		self:  self,
+		peers: peers,
+		call:  call,
+		randTimeout: func() int {
+			return defaultElectionTicks + rand.Intn(defaultElectionTicks)
+		},
+		logf: func(string, ...interface{}) {},
+	}
+	r.timeout = r.randTimeout()
+	return r
+}
+
+func (r *raft) IsLeader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.role == leader
+}
+
+//run 每隔 defaultTickInterval 调用一次 tick
+func (r *raft) run() {
+	ticker := time.NewTicker(defaultTickInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.tick()
+	}
+}
+
+//tick 推进一个时间单位，leader 定期发送心跳，其他角色在选举超时后发起选举
+func (r *raft) tick() {
+	r.mu.Lock()
+	r.elapsed++
+	if r.role == leader {
+		r.sinceQuorum++
+		if r.sinceQuorum >= defaultElectionTicks {
+			r.logf("lost quorum at term %d", r.term)
+			r.becomeFollower(r.term)
+			r.mu.Unlock()
+			return
+		}
+		send := r.elapsed >= defaultHeartbeatTicks
+		if send {
+			r.elapsed = 0
+		}
+		r.mu.Unlock()
+		if send {
+			r.broadcastHeartbeat()
+		}
+		return
+	}
+	timeout := r.elapsed >= r.timeout
+	r.mu.Unlock()
+
+	if timeout {
+		r.campaign()
+	}
+}
+
+//resetTimeout 重新开始计算选举超时，调用时需持有 r.mu
+func (r *raft) resetTimeout() {
+	r.elapsed = 0
+	r.timeout = r.randTimeout()
+}
+
+//majority 返回赢得选举所需的票数
+func (r *raft) majority() int {
+	return (len(r.peers)+1)/2 + 1
+}
+
+//becomeFollower 转为 term 任期的 follower，调用时需持有 r.mu
+func (r *raft) becomeFollower(term uint64) {
+	if term > r.term {
+		r.term = term
+		r.votedFor = ""
+	}
+	if r.role != follower {
+		r.logf("become follower at term %d", term)
+	}
+	r.role = follower
+	r.leader = ""
+	r.resetTimeout()
+}
+
+//stepDown 收到更高的任期时转为 follower，返回是否转换
+func (r *raft) stepDown(term uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term <= r.term {
+		return false
+	}
+	r.becomeFollower(term)
+	return true
+}
+
+//campaign 发起一轮选举，获得多数票后成为 leader，所有哨兵都回复或者已经得到多数票时返回
+func (r *raft) campaign() {
+	r.mu.Lock()
+	r.term++
+	r.role = candidate
+	r.votedFor = r.self
+	r.leader = ""
+	r.resetTimeout()
+	term := r.term
+	r.mu.Unlock()
+	r.logf("start election at term %d", term)
+
+	//并行地请求投票，得到多数票后立即成为 leader，不可达的哨兵不会拖慢选举
+	//容量足够容纳所有回复，选举结束后返回的请求不会阻塞
+	replies := make(chan *voteReply, len(r.peers))
+	for _, peer := range r.peers {
+		go func(peer string) {
+			reply := voteReply{}
+			if err := r.call(peer, "vote", voteArgs{Term: term, Candidate: r.self}, &reply); err != nil {
+				replies <- nil
+				return
+			}
+			replies <- &reply
+		}(peer)
+	}
+	votes := 1
+	for i := 0; i < len(r.peers) && votes < r.majority(); i++ {
+		reply := <-replies
+		if reply == nil {
+			continue
+		}
+		if r.stepDown(reply.Term) {
+			return
+		}
+		if reply.Granted {
+			votes++
+		}
+	}
+
+	r.mu.Lock()
+	if r.role != candidate || r.term != term || votes < r.majority() {
+		r.mu.Unlock()
+		return
+	}
+	r.role = leader
+	r.leader = r.self
+	r.elapsed = 0
+	r.sinceQuorum = 0
+	r.mu.Unlock()
+	r.logf("become leader at term %d with %d votes", term, votes)
+
+	r.broadcastHeartbeat()
+	if r.onLeader != nil {
+		r.onLeader()
+	}
+}
+
+//broadcastHeartbeat 并行地向其他哨兵发送心跳，维持 leader 地位，一个哨兵不可达时不会推迟发给其他哨兵的心跳。
+//得到多数哨兵的响应时重新开始计算 sinceQuorum
+func (r *raft) broadcastHeartbeat() {
+	r.mu.Lock()
+	if r.role != leader {
+		r.mu.Unlock()
+		return
+	}
+	args := heartbeatArgs{Term: r.term, Leader: r.self}
+	r.mu.Unlock()
+	if r.epoch != nil {
+		args.Epoch = r.epoch()
+	}
+
+	replies := make([]*heartbeatReply, len(r.peers))
+	var wg sync.WaitGroup
+	for i, peer := range r.peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			reply := heartbeatReply{}
+			if err := r.call(peer, "heartbeat", args, &reply); err == nil {
+				replies[i] = &reply
+			}
+		}(i, peer)
+	}
+	wg.Wait()
+
+	acks := 1
+	for _, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		if r.stepDown(reply.Term) {
+			return
+		}
+		acks++
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.role == leader && r.term == args.Term && acks >= r.majority() {
+		r.sinceQuorum = 0
+	}
+}
+
+//handleVote 处理 RequestVote，每个任期只投一票
+func (r *raft) handleVote(args voteArgs) voteReply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if args.Term > r.term {
+		r.becomeFollower(args.Term)
+	}
+	if args.Term < r.term {
+		return voteReply{Term: r.term}
+	}
+	if r.votedFor == "" || r.votedFor == args.Candidate {
+		r.votedFor = args.Candidate
+		r.resetTimeout()
+		return voteReply{Term: r.term, Granted: true}
+	}
+	return voteReply{Term: r.term}
+}
+
+//handleHeartbeat 处理 leader 的心跳，过期任期的心跳会被拒绝
+func (r *raft) handleHeartbeat(args heartbeatArgs) heartbeatReply {
+	reply := r.acceptHeartbeat(args)
+	if reply.Success && r.observe != nil {
+		r.observe(args.Epoch)
+	}
+	return reply
+}
+
+func (r *raft) acceptHeartbeat(args heartbeatArgs) heartbeatReply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if args.Term < r.term {
+		return heartbeatReply{Term: r.term}
+	}
+	if args.Term > r.term || r.role != follower {
+		r.becomeFollower(args.Term)
+	}
+	r.leader = args.Leader
+	r.resetTimeout()
+	return heartbeatReply{Term: r.term, Success: true}
+}
@@ -0,0 +1,215 @@
+package sentinel
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+//fixTimeouts 为每个哨兵设置固定的选举超时，第 i 个哨兵为 base*(i+1) 个 tick
+func fixTimeouts(sentinels []*HTTPSentinel, base int) {
+	for i, s := range sentinels {
+		timeout := base * (i + 1)
+		s.raft.randTimeout = func() int { return timeout }
+		s.raft.timeout = timeout
+	}
+}
+
+//tickAll 让所有未被隔离的哨兵推进 n 个 tick
+func tickAll(sentinels []*HTTPSentinel, n int) {
+	for i := 0; i < n; i++ {
+		for _, s := range sentinels {
+			s.raft.tick()
+		}
+	}
+}
+
+//leaders 返回认为自己是 leader 的哨兵
+func leaders(sentinels []*HTTPSentinel) []*HTTPSentinel {
+	var res []*HTTPSentinel
+	for _, s := range sentinels {
+		if s.elector.IsLeader() {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func TestElection(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, _ := startTestSentinels(network, 3, 2, peers)
+	fixTimeouts(sentinels, 5)
+
+	tickAll(sentinels, 5)
+	if l := leaders(sentinels); len(l) != 1 || l[0] != sentinels[0] {
+		t.Fatalf("sentinel-0 should be the only leader, got %v", l)
+	}
+	//leader 的心跳会阻止其他哨兵发起选举
+	tickAll(sentinels, 50)
+	if l := leaders(sentinels); len(l) != 1 || l[0] != sentinels[0] || sentinels[0].raft.term != 1 {
+		t.Fatalf("sentinel-0 should stay leader at term 1, got %v", l)
+	}
+
+	//leader 被隔离后，剩下的哨兵在更高的任期选出新的 leader
+	network.cut[sentinels[0].self] = true
+	tickAll(sentinels[1:], 10)
+	if !sentinels[1].elector.IsLeader() || sentinels[1].raft.term != 2 {
+		t.Fatalf("sentinel-1 should be leader at term 2, term %d", sentinels[1].raft.term)
+	}
+
+	//旧的 leader 恢复后，收到更高的任期时退位
+	delete(network.cut, sentinels[0].self)
+	tickAll(sentinels, defaultHeartbeatTicks)
+	if l := leaders(sentinels); len(l) != 1 || l[0] != sentinels[1] {
+		t.Fatalf("sentinel-1 should be the only leader, got %v", l)
+	}
+	if term := sentinels[0].raft.term; term != 2 {
+		t.Fatalf("sentinel-0 should follow term 2, got %d", term)
+	}
+}
+
+func TestElectionMinority(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, _ := startTestSentinels(network, 3, 2, peers)
+	fixTimeouts(sentinels, 5)
+
+	//只剩一个哨兵时无法获得多数票，不能成为 leader
+	network.cut[sentinels[1].self] = true
+	network.cut[sentinels[2].self] = true
+	tickAll(sentinels[:1], 20)
+	if len(leaders(sentinels)) != 0 {
+		t.Fatalf("a minority should not elect a leader")
+	}
+}
+
+func TestCheckQuorum(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, _ := startTestSentinels(network, 3, 2, peers)
+	fixTimeouts(sentinels, 5)
+	tickAll(sentinels, 5)
+	if !sentinels[0].elector.IsLeader() {
+		t.Fatal("sentinel-0 should be leader")
+	}
+
+	//只有 leader 被隔离，收不到更高任期的消息，在一个选举超时之内退位
+	network.cut[sentinels[0].self] = true
+	tickAll(sentinels[:1], defaultElectionTicks)
+	if sentinels[0].elector.IsLeader() {
+		t.Fatal("a leader without a majority should step down")
+	}
+
+	//只有一个哨兵不可达时 leader 仍然可以得到多数响应
+	delete(network.cut, sentinels[0].self)
+	for i := 0; i < 100 && len(leaders(sentinels)) == 0; i++ {
+		tickAll(sentinels, 1)
+	}
+	l := leaders(sentinels)
+	if len(l) != 1 {
+		t.Fatalf("expected one leader, got %v", l)
+	}
+	for _, s := range sentinels {
+		if s != l[0] {
+			network.cut[s.self] = true
+			break
+		}
+	}
+	tickAll(l, 3*defaultElectionTicks)
+	if !l[0].elector.IsLeader() {
+		t.Fatal("a leader acked by a majority should stay leader")
+	}
+}
+
+func TestOnlyLeaderBroadcasts(t *testing.T) {
+	network := newMemNetwork()
+	sentinels, probers := startTestSentinels(network, 3, 2, peers)
+	fixTimeouts(sentinels, 5)
+	peer := peers[0]
+
+	//所有哨兵都判定 peer 客观下线，但还没有 leader，谁都不广播
+	for _, p := range probers {
+		p.set(peer, true)
+	}
+	for _, s := range sentinels {
+		for _, p := range peers {
+			s.check(p)
+		}
+	}
+	for _, s := range sentinels {
+		for _, msg := range pending(s) {
+			s.broadcast(msg)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	network.mu.Lock()
+	n := len(network.notified)
+	network.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("followers should not notify cache servers, got %d messages", n)
+	}
+
+	//新选出的 leader 会重新广播已经下线的结点，以及存活的结点
+	tickAll(sentinels, 5)
+	var down failMsg
+	events := make(map[string]string)
+	for _, msg := range pending(sentinels[0]) {
+		events[msg.PeerName] = msg.Event
+		if msg.Event == eventDown {
+			down = msg
+		}
+	}
+	if len(events) != len(peers) || events[peer] != eventDown {
+		t.Fatalf("new leader should announce %s down, got %v", peer, events)
+	}
+	for _, p := range peers[1:] {
+		if events[p] != eventUp {
+			t.Fatalf("new leader should announce %s up, got %v", p, events)
+		}
+	}
+	sentinels[0].broadcast(down)
+
+	want := len(peers) - 1
+	for deadline := time.Now().Add(time.Second); ; {
+		network.mu.Lock()
+		n = len(network.notified)
+		network.mu.Unlock()
+		if n == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("leader should notify %d alive peers, got %d", want, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCampaignParallel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	r := newRaft("a", []string{"b", "c", "d", "e"}, func(addr, method string, args, reply interface{}) error {
+		//c 和 d 的投票请求一直等到超时
+		if addr == "c" || addr == "d" {
+			if method == "vote" {
+				<-release
+			}
+			return errors.New("timeout")
+		}
+		if vote, ok := reply.(*voteReply); ok {
+			vote.Granted = true
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.campaign()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("campaign should not wait for unreachable sentinels once it has a majority")
+	}
+	if !r.IsLeader() {
+		t.Fatal("3 of 5 votes should win the election")
+	}
+}
@@ -1,13 +1,9 @@
 package sentinel
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"regexp"
+	"sync"
 	"time"
 )
 
@@ -24,16 +20,33 @@ type HTTPSentinel struct {
 	self            string
 	//waitTime        time.Duration
 	requestInterval time.Duration
-	peers			map[string]bool
+	mu              sync.Mutex
+	peers			map[string]bool	//结点是否存活，由 mu 保护
+	failed          map[string]bool	//已经通知过下线的结点，恢复后需要通知上线，由 mu 保护
 	ch              chan failMsg
+	prober          Prober	//探测结点是否存活的方式，默认使用不需要特殊权限的 TCPProber
+	sentinels       []string	//多哨兵模式下其他哨兵的地址，由 mu 保护
+	quorum          int	//判定结点客观下线所需的哨兵数，默认为 1 即单哨兵模式，由 mu 保护
+	reports         map[string]map[string]report	//结点 -> 哨兵 -> 该哨兵的主观判断，由 mu 保护
+	transport       transport
+	elector         Elector	//决定是否由自己广播 failMsg，单哨兵模式下总是 leader
+	raft            *raft	//多哨兵模式下的选主，单哨兵模式下为 nil
+	epoch           uint64	//最近一条消息的 epoch，由 mu 保护
 }
 
 type failMsg struct {
 	DetectedTime time.Time 	`json:"detected_time"`
 	SentinelName string 	`json:"sentinel_name"`
 	PeerName string			`json:"peer_name"`
+	Event string			`json:"event"`	//eventDown 或 eventUp，为空时视为 eventDown
+	Epoch uint64			`json:"epoch"`	//单调递增，缓存结点据此忽略被延迟或者乱序的消息
 }
 
+const (
+	eventDown = "down"	//结点下线
+	eventUp   = "up"	//下线的结点重新上线
+)
+
 func (S *HTTPSentinel) Log(format string, v ...interface{}) {
 	log.Printf("[Sentinel %s] %s", S.self, fmt.Sprintf(format, v...))
 }
@@ -44,7 +57,13 @@ func NewSentinel (self string, peers []string, waitTime time.Duration, requestIn
 		//waitTime:        waitTime,
 		requestInterval: requestInterval,
 		peers: make(map[string]bool, len(peers)),
+		failed: make(map[string]bool),
 		ch: make(chan failMsg, len(peers) * 3),
+		prober: &TCPProber{},
+		quorum: 1,
+		reports: make(map[string]map[string]report),
+		transport: newHTTPTransport(),
+		elector: alwaysLeader{},
 	}
 
 	for _, v := range peers {
@@ -62,77 +81,150 @@ func NewSentinel (self string, peers []string, waitTime time.Duration, requestIn
 	return sentinel
 }
 
+// SetProber 设置探测结点的方式，需要在 HeartBeating 之前调用
+func (S *HTTPSentinel) SetProber(p Prober) {
+	S.prober = p
+}
+
 func (S *HTTPSentinel) HeartBeating() {
+	S.mu.Lock()
+	defer S.mu.Unlock()
 	for k, _ := range S.peers {
 		go S.RecvHttpMsg(k)
 	}
+	if S.raft != nil {
+		go S.raft.run()
+	}
 }
 
+//RecvHttpMsg 定时探测 peer，结点下线后也会继续探测，以便在其恢复后通知其他结点
 func (S *HTTPSentinel) RecvHttpMsg(peer string) {
 	ticker := time.NewTicker(S.requestInterval)
-	op := NewPingOption(defaultPingCount, defaultPingSize, int64(defaultPingTime))
-	//使用正则表达式提取Addr
-	r := regexp.MustCompile("[a-zA-Z0-9]+")
-	//割后变成[http localhost 8001]
-	peerAddrs := r.FindAllString(peer, -1)
-	//选择localhost
-	peerAddr := peerAddrs[1]
+	defer ticker.Stop()
 
 	for range ticker.C {
-		t := 0
-		for i := 0; i < 3; i++ {
-			if res := Ping(peerAddr, op); res == false {
-				t++
-			}
+		S.check(peer)
+	}
+}
+
+//check 对 peer 进行一轮探测，3次中有2次失败则判定结点主观下线，
+//达到 quorum 个哨兵主观下线时发出 failMsg，已下线的结点重新探测成功时发出 eventUp 消息，返回结点是否存活
+func (S *HTTPSentinel) check(peer string) bool {
+	t := 0
+	for i := 0; i < 3; i++ {
+		if err := S.prober.Probe(peer); err != nil {
+			S.Log("probe %s failed: %v", peer, err)
+			t++
 		}
-		if  t >= 2 {
-			S.peers[peer] = false
-
-			failMsg := failMsg{
-				DetectedTime: time.Now(),
-				PeerName: peer,
-				SentinelName: S.self,
-			}
-			S.ch <- failMsg
-
-			S.Log("%s %s","connect failed with", peer)
-			ticker.Stop()
-
-		} else {
-			S.Log("%s %s", "connect successfully with", peer)
-			S.peers[peer] = true
+	}
+
+	alive := t < 2
+	if alive {
+		S.Log("%s %s", "connect successfully with", peer)
+	} else {
+		S.Log("%s %s", "connect failed with", peer)
+	}
+	S.mu.Lock()
+	S.peers[peer] = alive
+	S.mu.Unlock()
+
+	S.setSubjective(peer, !alive)
+	return alive
+}
+
+//newMsg 创建一条消息并为其分配新的 epoch，调用时需持有 S.mu
+func (S *HTTPSentinel) newMsg(peer string, event string) failMsg {
+	return failMsg{
+		DetectedTime: time.Now(),
+		PeerName: peer,
+		SentinelName: S.self,
+		Event: event,
+		Epoch: S.nextEpoch(),
+	}
+}
+
+//nextEpoch 返回下一个 epoch，调用时需持有 S.mu。
+//epoch 取当前时间的纳秒数，这样哨兵重启之后 epoch 依然是递增的；时钟回拨时在上一个 epoch 的基础上加 1
+func (S *HTTPSentinel) nextEpoch() uint64 {
+	epoch := uint64(time.Now().UnixNano())
+	if epoch <= S.epoch {
+		epoch = S.epoch + 1
+	}
+	S.epoch = epoch
+	return epoch
+}
+
+//currentEpoch 返回最近一条消息的 epoch
+func (S *HTTPSentinel) currentEpoch() uint64 {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	return S.epoch
+}
+
+//observeEpoch 记录其他哨兵使用过的 epoch，保证自己成为 leader 之后发出的消息的 epoch 更大
+func (S *HTTPSentinel) observeEpoch(epoch uint64) {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	if epoch > S.epoch {
+		S.epoch = epoch
+	}
+}
+
+//alivePeers 返回当前存活的结点
+func (S *HTTPSentinel) alivePeers() []string {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	var res []string
+	for peer, status := range S.peers {
+		if status == true {
+			res = append(res, peer)
 		}
 	}
+	return res
 }
 
 func (S *HTTPSentinel) HandleFailMsg() {
 	for  {
-		msg := <-S.ch
-		S.Log("%s %s", "handle failed peer", msg.PeerName)
-		for peer, status := range S.peers {
-			if status == true {
-				go S.SendFailPeer(peer, msg)
-			}
-		}
+		S.broadcast(<-S.ch)
 	}
 }
 
-func (S *HTTPSentinel) SendFailPeer(peer string, Msg failMsg) {
-	url := peer + defaultPUTPath
+//broadcast 把 msg 发送给所有存活的结点，多哨兵模式下只有 leader 会发送
+func (S *HTTPSentinel) broadcast(msg failMsg) {
+	if !S.elector.IsLeader() {
+		S.Log("not leader, skip %s peer %s", msg.Event, msg.PeerName)
+		return
+	}
+	S.Log("handle %s peer %s", msg.Event, msg.PeerName)
+	for _, peer := range S.alivePeers() {
+		go S.SendFailPeer(peer, msg)
+	}
+}
 
-	body, _ := json.Marshal(Msg)
-	buf := bytes.NewReader(body)
+//announcePeers 重新广播所有结点的状态，已下线的结点发送 eventDown，存活的结点发送 eventUp。
+//新的 leader 无法确定之前的 leader 是否已经通知过缓存结点，例如旧 leader 可能在广播结点恢复之前就失去了 leader 地位
+func (S *HTTPSentinel) announcePeers() {
+	S.mu.Lock()
+	var msgs []failMsg
+	for peer, alive := range S.peers {
+		if S.failed[peer] {
+			msgs = append(msgs, S.newMsg(peer, eventDown))
+		} else if alive {
+			msgs = append(msgs, S.newMsg(peer, eventUp))
+		}
+	}
+	S.mu.Unlock()
 
-	req, _ := http.NewRequest("PUT", url, buf)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		S.Log("%s %s %v", "send new peers failed to", url, err)
+	for _, msg := range msgs {
+		S.ch <- msg
 	}
+}
 
-	body, err = ioutil.ReadAll(resp.Body)
+func (S *HTTPSentinel) SendFailPeer(peer string, Msg failMsg) {
+	body, err := S.transport.notify(peer, Msg)
 	if err != nil {
-		S.Log("%v", err)
+		S.Log("%s %s %v", "send new peers failed to", peer+defaultPUTPath, err)
+		return
 	}
 	S.Log("%s", string(body))
 }
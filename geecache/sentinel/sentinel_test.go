@@ -1,9 +1,11 @@
 package sentinel
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"reflect"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -16,46 +18,155 @@ var (
 	}
 )
 
-func Handle (w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write([]byte("hello"))
+//fakeProber 按照 down 中记录的状态返回探测结果
+type fakeProber struct {
+	mu   sync.Mutex
+	down map[string]bool
 }
 
-func startHttpServer()  {
-	http.HandleFunc("/_geecache/", Handle)
-	for i := 1; i <= 3; i++ {
-		go http.ListenAndServe("127.0.0.1:800" + fmt.Sprint(i), nil)
+func (f *fakeProber) Probe(peer string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down[peer] {
+		return fmt.Errorf("%s is down", peer)
 	}
+	return nil
+}
+
+func (f *fakeProber) set(peer string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down == nil {
+		f.down = make(map[string]bool)
+	}
+	f.down[peer] = down
+}
+
+//startTestPeers 启动 n 个记录哨兵消息的 HTTP 服务器
+func startTestPeers(t *testing.T, n int) ([]string, chan failMsg) {
+	ch := make(chan failMsg, 16)
+	var addrs []string
+	for i := 0; i < n; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == defaultPUTPath {
+				msg := failMsg{}
+				json.NewDecoder(r.Body).Decode(&msg)
+				ch <- msg
+			}
+			w.Write([]byte("hello"))
+		}))
+		t.Cleanup(server.Close)
+		addrs = append(addrs, server.URL)
+	}
+	return addrs, ch
 }
 
 func TestPing(t *testing.T) {
 	p := NewPingOption(4, 32, 1000)
+	//没有权限时返回 false，但不能 panic 或者退出进程
 	fmt.Println(Ping("localhost", p))
 }
 
+func TestProbers(t *testing.T) {
+	addrs, _ := startTestPeers(t, 1)
+	for _, p := range []Prober{&TCPProber{}, &HTTPProber{}} {
+		if err := p.Probe(addrs[0]); err != nil {
+			t.Fatalf("%T should reach %s: %v", p, addrs[0], err)
+		}
+		if err := p.Probe("http://127.0.0.1:1"); err == nil {
+			t.Fatalf("%T should fail on a closed port", p)
+		}
+	}
+	if err := (&ICMPProber{}).Probe("http://no-such-host.invalid:8001"); err == nil {
+		t.Fatal("ICMPProber should fail on an unknown host")
+	}
+	if _, err := NewProber("udp"); err == nil {
+		t.Fatal("NewProber should reject unknown probers")
+	}
+}
+
 func TestHeartBeating(t *testing.T) {
-	go startHttpServer()
+	addrs, _ := startTestPeers(t, 3)
 
-	s := NewSentinel("http://localhost:10000", peers, 0, 0)
+	s := NewSentinel("http://localhost:10000", addrs, 0, 50 * time.Millisecond)
 	s.HeartBeating()
-	time.Sleep(10 * time.Second)
+	time.Sleep(200 * time.Millisecond)
+	if alive := s.alivePeers(); len(alive) != 3 {
+		t.Fatalf("all peers should be alive, got %v", alive)
+	}
 }
 
 func TestHandleFailMsg(t *testing.T) {
-	go startHttpServer()
-
-	s := NewSentinel("http://localhost:10000", peers, 0, 0)
-	go s.HeartBeating()
-	s.HandleFailMsg()
-	//假如停掉8003的端口
-	if !reflect.DeepEqual(s.peers, []string{
-		"http://localhost:8001",
-		"http://localhost:8002",
-	}) {
-		t.Fail()
-	}
-	//再次停掉8001和8002端口
-	if s.peers != nil {
-		t.Fatal()
+	addrs, ch := startTestPeers(t, 3)
+	prober := &fakeProber{}
+
+	s := NewSentinel("http://localhost:10000", addrs, 0, 0)
+	s.SetProber(prober)
+	go s.HandleFailMsg()
+	for _, peer := range addrs {
+		if !s.check(peer) {
+			t.Fatalf("%s should be alive", peer)
+		}
+	}
+
+	//假如停掉第3个结点
+	prober.set(addrs[2], true)
+	if s.check(addrs[2]) {
+		t.Fatalf("%s should be down", addrs[2])
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-ch:
+			if msg.PeerName != addrs[2] || msg.SentinelName != "http://localhost:10000" {
+				t.Fatalf("unexpected failMsg %+v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("alive peers should be told about the failed peer")
+		}
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("the failed peer should not be notified, got %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRecoverPeer(t *testing.T) {
+	addrs, ch := startTestPeers(t, 2)
+	prober := &fakeProber{}
+
+	s := NewSentinel("http://localhost:10000", addrs, 0, 0)
+	s.SetProber(prober)
+	go s.HandleFailMsg()
+	for _, peer := range addrs {
+		s.check(peer)
+	}
+
+	prober.set(addrs[1], true)
+	s.check(addrs[1])
+	//已经下线的结点再次探测失败时不会重复通知
+	s.check(addrs[1])
+	if msg := <-ch; msg.PeerName != addrs[1] || msg.Event != eventDown {
+		t.Fatalf("expect down message for %s, got %+v", addrs[1], msg)
+	}
+
+	prober.set(addrs[1], false)
+	if !s.check(addrs[1]) {
+		t.Fatalf("%s should be alive again", addrs[1])
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-ch:
+			if msg.PeerName != addrs[1] || msg.Event != eventUp {
+				t.Fatalf("expect up message for %s, got %+v", addrs[1], msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("all alive peers should be told about the recovered peer")
+		}
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(100 * time.Millisecond):
 	}
 }
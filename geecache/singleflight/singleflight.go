@@ -1,10 +1,13 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
-// call 正在进行中或者已经结束的请求,使用 sync.WaitGroup 锁避免重入
+// call 正在进行中或者已经结束的请求,请求结束时关闭 done 以唤醒所有等待者
 type call struct {
-	wg sync.WaitGroup
+	done chan struct{}
 	val interface{}
 	err error
 }
@@ -23,22 +26,48 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 
 	if c, ok := g.m[key]; ok {		//如果g.m中存在要查询的key
 		g.mu.Unlock()				//那么就代表不需要修改g.m，解锁
-		c.wg.Wait()					//Wait等待，直到可以获取c为止
+		<-c.done					//等待，直到请求结束为止
 		return c.val, c.err
 	}
 
-	c := new(call)
-	c.wg.Add(1)				//发起请求前加锁
+	c := &call{done: make(chan struct{})}
 	g.m[key] = c
 	g.mu.Unlock()					//修改完g.m之后就可以释放g.mu了
 
-	c.val, c.err = fn()				//调用fn，发起请求
-	c.wg.Done()						//请求结束，释放锁
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
 
+// DoContext 与 Do 相同，但无论是发起请求者还是等待者，都会在 ctx 结束时立即返回 ctx.Err()
+// fn 会在单独的 goroutine 中继续执行完毕，其结果仍然会交给其他未超时的等待者
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
-	delete(g.m, key)				//c的值获取完成后将key剔除，以方便之后可能出现的对key再次修改的请求
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+
+	c, ok := g.m[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.m[key] = c
+		go g.doCall(c, key, fn)
+	}
 	g.mu.Unlock()
 
-	return c.val, c.err
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
+//doCall 调用fn发起请求，结束后唤醒等待者并将key剔除
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	c.val, c.err = fn()				//调用fn，发起请求
+	close(c.done)					//请求结束，唤醒等待者
+
+	g.mu.Lock()
+	delete(g.m, key)				//c的值获取完成后将key剔除，以方便之后可能出现的对key再次修改的请求
+	g.mu.Unlock()
+}
@@ -0,0 +1,64 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+			if err != nil || v.(string) != "value" {
+				t.Errorf("Do got %v %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("fn should be called once, got %d", calls)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := g.DoContext(ctx, "key", func() (interface{}, error) {
+		<-release
+		return "value", nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("DoContext should return DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("DoContext should return as soon as ctx is done")
+	}
+
+	v, err := g.DoContext(context.Background(), "other", func() (interface{}, error) {
+		return "value", nil
+	})
+	if err != nil || v.(string) != "value" {
+		t.Fatalf("DoContext got %v %v", v, err)
+	}
+}
@@ -0,0 +1,82 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+//AtomicInt 是可以并发读写的计数器
+type AtomicInt int64
+
+// Add 原子地加上 n
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get 原子地读取当前值
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+//Stats 是 Group 的计数器，所有字段都可以并发更新
+type Stats struct {
+	Gets           AtomicInt //所有的查询请求，包括来自其他结点的请求
+	CacheHits      AtomicInt //mainCache 或 hotCache 命中的次数
+	PeerLoads      AtomicInt //从远程结点成功获取的次数
+	PeerErrors     AtomicInt //从远程结点获取失败的次数
+	Loads          AtomicInt //缓存未命中需要加载的次数，等于 Gets - CacheHits
+	LoadsDeduped   AtomicInt //实际执行的加载次数：经过 singleflight 合并之后的加载，一次批量加载或批量请求只算一次
+	LocalLoads     AtomicInt //通过 Getter 成功加载的次数
+	LocalLoadErrs  AtomicInt //通过 Getter 加载失败的次数
+	ServerRequests AtomicInt //来自其他结点的请求次数
+	ReplicaLoads   AtomicInt //主结点失败之后从副本结点成功获取的次数
+	FailoverLoads  AtomicInt //所属结点失败之后从哈希环上后续结点(包括自己)成功获取的次数
+	HedgesSent     AtomicInt //发出的对冲请求数
+	HedgesWon      AtomicInt //对冲请求先于原请求返回的次数
+}
+
+//GroupStats 是某一时刻 Group 统计信息的快照，可以直接编码为 JSON
+type GroupStats struct {
+	Name           string     `json:"name"`
+	Gets           int64      `json:"gets"`
+	CacheHits      int64      `json:"cache_hits"`
+	PeerLoads      int64      `json:"peer_loads"`
+	PeerErrors     int64      `json:"peer_errors"`
+	Loads          int64      `json:"loads"`
+	LoadsDeduped   int64      `json:"loads_deduped"`
+	LocalLoads     int64      `json:"local_loads"`
+	LocalLoadErrs  int64      `json:"local_load_errs"`
+	ServerRequests int64      `json:"server_requests"`
+	ReplicaLoads   int64      `json:"replica_loads"`
+	FailoverLoads  int64      `json:"failover_loads"`
+	HedgesSent     int64      `json:"hedges_sent"`
+	HedgesWon      int64      `json:"hedges_won"`
+	MainCache      CacheStats `json:"main_cache"`
+	HotCache       CacheStats `json:"hot_cache"`
+}
+
+// Stats 返回 Group 当前的统计信息，其中 Loads - LoadsDeduped 即为被 singleflight 或批量加载合并的加载次数
+func (g *Group) Stats() GroupStats {
+	return GroupStats{
+		Name:           g.name,
+		Gets:           g.stats.Gets.Get(),
+		CacheHits:      g.stats.CacheHits.Get(),
+		PeerLoads:      g.stats.PeerLoads.Get(),
+		PeerErrors:     g.stats.PeerErrors.Get(),
+		Loads:          g.stats.Loads.Get(),
+		LoadsDeduped:   g.stats.LoadsDeduped.Get(),
+		LocalLoads:     g.stats.LocalLoads.Get(),
+		LocalLoadErrs:  g.stats.LocalLoadErrs.Get(),
+		ServerRequests: g.stats.ServerRequests.Get(),
+		ReplicaLoads:   g.stats.ReplicaLoads.Get(),
+		FailoverLoads:  g.stats.FailoverLoads.Get(),
+		HedgesSent:     g.stats.HedgesSent.Get(),
+		HedgesWon:      g.stats.HedgesWon.Get(),
+		MainCache:      g.mainCache.stats(),
+		HotCache:       g.hotCache.stats(),
+	}
+}
@@ -25,11 +25,22 @@ package main
 
 import (
 	"cache/geecache"
+	"cache/geecache/gossip"
+	"cache/geecache/pb"
+	"cache/geecache/placement"
 	"cache/geecache/sentinel"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"google.golang.org/grpc"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -40,6 +51,28 @@ var (
 	}
 
 	sentinelAddr = "http://localhost:10000"
+
+	//apiTimeout 是API服务处理每个请求的最长时间，避免慢结点或者慢查询一直阻塞请求
+	apiTimeout = 3 * time.Second
+
+	//loadEpsilon 大于 0 时结点间使用有界负载的一致性哈希，由 -epsilon 设置
+	loadEpsilon float64
+
+	//placementName 是结点间选择结点的算法，由 -placement 设置，为 ring 时使用 HTTPPool 默认的一致性哈希环
+	placementName = "ring"
+
+	//replication 是 scores 中每个 key 保存的结点数，pushReplicas 表示是否把加载到的数据推送给副本，由 -replication 和 -push 设置
+	replication  = 1
+	pushReplicas bool
+
+	//failover 是从远程结点获取失败之后的行为，由 -nextpeers、-skipcache 和 -failfast 设置
+	failover geecache.Failover
+
+	//hedgeDelay 大于 0 时开启对冲请求，由 -hedge 设置
+	hedgeDelay time.Duration
+
+	//adminToken 是访问 /_admin/peers 和推送副本需要的令牌，为空时关闭这两个接口，由 -admintoken 设置
+	adminToken string
 )
 
 func createGroup() *geecache.Group {
@@ -50,38 +83,111 @@ func createGroup() *geecache.Group {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), geecache.WithReplication(replication, pushReplicas), geecache.WithFailover(failover),
+		geecache.WithHedging(hedgeDelay))
 }
 
 //startCacheServer 用来启动缓存服务器，创建HTTPPool，添加结点信息，注册到gee中,
-//启动http服务,一共三个端口，用户不感知
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
+//启动http服务,一共三个端口，用户不感知。weights 是所有结点的地址及其权重
+func startCacheServer(addr string, weights map[string]int, gee *geecache.Group) {
+	peers := geecache.NewHTTPPoolOpts(addr, &geecache.HTTPPoolOptions{AdminToken: adminToken})
 	//对每一个结点都要告知其他结点的地址
-	peers.Set(addrs...)
+	setPlacement(peers)
+	peers.SetWeighted(weights)
+	peers.SetBoundedLoad(loadEpsilon)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at:", addr)
+	serveCache(addr, peers, http.NewServeMux())
+}
+
+//setPlacement 根据 -placement 设置 peers 选择结点的算法
+func setPlacement(peers *geecache.HTTPPool) {
+	if placementName == "ring" {
+		return
+	}
+	peers.SetPlacement(func() placement.Placement {
+		p, _ := placement.New(placementName, 0)
+		return p
+	})
+}
+
+//startGossipCacheServer 与 startCacheServer 相同，但不需要事先知道所有结点的地址，
+//结点通过 seed 加入集群，之后由 gossip 协议维护结点列表
+func startGossipCacheServer(addr string, seed string, gee *geecache.Group) {
+	peers := geecache.NewHTTPPoolOpts(addr, &geecache.HTTPPoolOptions{AdminToken: adminToken})
+	setPlacement(peers)
+	//加入集群之前只有自己
+	peers.Set(addr)
+	peers.SetBoundedLoad(loadEpsilon)
+	members := gossip.New(addr, gossip.Config{
+		OnChange: func(addrs []string) {
+			peers.Set(addrs...)
+		},
+	})
+	gee.RegisterPeers(peers)
+
 	mux := http.NewServeMux()
+	mux.Handle("/_gossip/", members)
+	go func() {
+		//等待 HTTP 服务启动之后再加入集群，seed 暂时不可用时重试
+		for {
+			time.Sleep(time.Second)
+			if err := members.Join(seed); err != nil {
+				log.Println("join", seed, "failed:", err)
+				continue
+			}
+			members.Run()
+		}
+	}()
+	log.Println("geecache is running at:", addr, "with seed", seed)
+	serveCache(addr, peers, mux)
+}
 
+//serveCache 在 mux 上注册缓存服务的路由并启动 http 服务
+func serveCache(addr string, peers *geecache.HTTPPool, mux *http.ServeMux) {
 	//由于采用ping替换http请求，此handleFunc已不再需要
 	//mux.HandleFunc("/_geecache", peers.ResponseStatus)
 
-	mux.HandleFunc("/_geecache/", peers.GetKey)
-	mux.HandleFunc("/sentinel", peers.ListenSentinel)
+	//HTTPPool 负责 /_geecache/、/sentinel、/_stats、/_admin/peers 和 /metrics，其余路径返回 404
+	mux.Handle("/", peers)
 	//fmt.Println("addr[7:]:", addr[7:])	//例如:localhost:8001
 	server := http.Server{
-		Addr: addr[7:],
+		Addr: hostOf(addr),
 		Handler: mux,
 	}
 	log.Fatal(server.ListenAndServe())
 }
 
+//startGRPCCacheServer 与 startCacheServer 相同，但结点间使用 gRPC 通信，addr 和 addrs 不带 http:// 前缀
+func startGRPCCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	peers := geecache.NewGRPCPool(addr)
+	peers.Set(addrs...)
+	gee.RegisterPeers(peers)
+	log.Println("geecache is running at:", addr, "with gRPC")
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterGroupCacheServer(server, peers)
+	log.Fatal(server.Serve(lis))
+}
+
 //startAPIServer 用来启动API服务，与用户进行交互，用户感知
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			if r.Method == http.MethodDelete {
+				if err := gee.Remove(key); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+			defer cancel()
+			view, err := gee.GetContext(ctx, key)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -89,19 +195,107 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 			w.Header().Set("Content-Type", "application/octet-stream")
 			w.Write(view.ByteSlice())
 		}))
+	//批量查询，例如 /api/multi?key=Tom&key=Jack，返回 key 到 value 的 JSON
+	http.Handle("/api/multi", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+			defer cancel()
+			views, err := gee.GetMultiContext(ctx, r.URL.Query()["key"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res := make(map[string]string, len(views))
+			for k, v := range views {
+				res[k] = v.String()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(res)
+		}))
 	log.Println("fontend server is running at", apiAddr)
 	//fmt.Println("apiAddr[7:]", apiAddr[7:])	//localhost:9999
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	log.Fatal(http.ListenAndServe(hostOf(apiAddr), nil))
+}
+
+//hostOf 返回 http://localhost:8001 形式的地址中的 localhost:8001，地址无法解析时退出
+func hostOf(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		log.Fatalf("invalid address: %q", addr)
+	}
+	return u.Host
+}
+
+//parseWeights 解析 8001=2,8002=1 形式的权重，没有指定权重的结点权重为 1
+func parseWeights(s string, addrMap map[int]string) (map[string]int, error) {
+	weights := make(map[string]int, len(addrMap))
+	for _, addr := range addrMap {
+		weights[addr] = 1
+	}
+	if s == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid weight %q", pair)
+		}
+		port, err := strconv.Atoi(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q: %v", pair, err)
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid weight %q", pair)
+		}
+		addr, ok := addrMap[port]
+		if !ok {
+			return nil, fmt.Errorf("unknown port %d", port)
+		}
+		weights[addr] = weight
+	}
+	return weights, nil
 }
 
 func main() {
 	var port int
 	var api bool
 	var sen bool
+	var useGRPC bool
+	var probe string
+	var senAddr string
+	var sentinels string
+	var quorum int
+	var seed string
+	var weights string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
 	flag.BoolVar(&sen, "sen", false, "start sentinel server")
+	flag.BoolVar(&useGRPC, "grpc", false, "Use gRPC between cache servers instead of HTTP")
+	flag.StringVar(&probe, "probe", "tcp", "How the sentinel probes cache servers: tcp, http or icmp")
+	flag.StringVar(&senAddr, "senaddr", sentinelAddr, "Sentinel address, other sentinels send reports to it")
+	flag.StringVar(&sentinels, "sentinels", "", "Comma separated addresses of all sentinels, empty for a single sentinel")
+	flag.IntVar(&quorum, "quorum", 1, "Number of sentinels that must agree before a cache server is marked down")
+	flag.StringVar(&seed, "seed", "", "Join the cluster through this cache server with gossip instead of the fixed address list")
+	flag.StringVar(&weights, "weights", "", "Comma separated port=weight pairs, e.g. 8001=2,8002=1, every node must use the same value")
+	flag.Float64Var(&loadEpsilon, "epsilon", 0, "Use consistent hashing with bounded loads, a peer may take at most (1+epsilon) times the average load")
+	flag.StringVar(&placementName, "placement", placementName, "How keys are assigned to cache servers: "+strings.Join(placement.Names, ", ")+", every node must use the same value. "+
+		"jump numbers cache servers in order, removing any server but the last (e.g. when the sentinel marks it down) moves most keys, so it does not work with -seed")
+	flag.IntVar(&replication, "replication", replication, "Number of cache servers that keep each key, the primary first and then its replicas")
+	flag.BoolVar(&pushReplicas, "push", false, "Push values loaded from the DB to the replicas, all cache servers need the same -admintoken")
+	flag.IntVar(&failover.NextPeers, "nextpeers", 0, "Number of following ring nodes to try when the owner of a key fails")
+	flag.BoolVar(&failover.SkipCache, "skipcache", false, "Do not cache keys owned by a failed peer after loading them from the DB")
+	flag.BoolVar(&failover.FailFast, "failfast", false, "Return an error instead of loading from the DB when all peers fail")
+	flag.DurationVar(&hedgeDelay, "hedge", 0, "Send a hedged request to a replica (or load from the DB without -replication) when the owner has not answered within this delay, 0 to disable")
+	flag.StringVar(&adminToken, "admintoken", "", "Token required as \"Authorization: Bearer <token>\" by /_admin/peers and by replica pushes, empty disables both")
 	flag.Parse()
+	if _, err := placement.New(placementName, 0); err != nil {
+		log.Fatal(err)
+	}
+	//gossip 模式下结点随时加入和离开，jump 每次都会重新分配大部分 key
+	if placementName == "jump" && seed != "" {
+		log.Fatal("-placement jump does not support dynamic membership with -seed")
+	}
 
 	apiAddr := "http://localhost:9999"
 	addrMap := map[int]string{
@@ -120,12 +314,43 @@ func main() {
 		go startAPIServer(apiAddr, gee)
 	}
 
+	if useGRPC {
+		//哨兵通过HTTP通知结点，gRPC模式下暂不支持
+		var grpcAddrs []string
+		for _, v := range addrs {
+			grpcAddrs = append(grpcAddrs, hostOf(v))
+		}
+		startGRPCCacheServer(hostOf(addrMap[port]), grpcAddrs, gee)
+		return
+	}
+
+	if seed != "" {
+		//gossip 模式下结点列表是动态的，不再使用 addrMap 和哨兵
+		startGossipCacheServer(fmt.Sprintf("http://localhost:%d", port), seed, gee)
+		return
+	}
+
 	if sen {
-		s := sentinel.NewSentinel(sentinelAddr, addrs, 0, 0)
+		s := sentinel.NewSentinel(senAddr, addrs, 0, 0)
+		prober, err := sentinel.NewProber(probe)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.SetProber(prober)
+		if sentinels != "" {
+			s.SetCluster(strings.Split(sentinels, ","), quorum)
+			go func() {
+				log.Fatal(http.ListenAndServe(hostOf(senAddr), s))
+			}()
+		}
 		go s.HeartBeating()
 		go s.HandleFailMsg()
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	peerWeights, err := parseWeights(weights, addrMap)
+	if err != nil {
+		log.Fatal(err)
+	}
+	startCacheServer(addrMap[port], peerWeights, gee)
 
 
 }
@@ -6,6 +6,10 @@ go build -o server
 ./server -port=8001 &
 ./server -port=8002 &
 ./server -port=8003 -api=1 -sen=1&
+#gossip 模式下只需要知道一个种子结点:
+#./server -port=8001 -seed=http://localhost:8001 &
+#./server -port=8002 -seed=http://localhost:8001 &
+#./server -port=8003 -seed=http://localhost:8001 -api=1 &
 
 sleep 2
 echo ">>> start test"